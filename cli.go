@@ -0,0 +1,464 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cmdbox/config"
+	"cmdbox/db"
+	"cmdbox/model"
+	"cmdbox/runner"
+)
+
+const usage = `usage:
+  cmdbox                               start the TUI
+  cmdbox run [--json] <name> [key=value ...]
+                                       run a saved command
+  cmdbox list [--tag TAG] [--json]     list saved commands
+  cmdbox export [--include-secrets]    print all commands and queries as JSON,
+                                       without connection passwords unless
+                                       --include-secrets
+  cmdbox import [--mode skip|overwrite|rename] <file>
+                                       add commands and queries from an
+                                       export ("-" reads stdin)
+  cmdbox vacuum                        compact the database file
+  cmdbox import-history [--shell zsh] [--limit N] [--file PATH]
+                                       save the most used commands from
+                                       your shell history
+  cmdbox serve [--socket PATH]         run saved commands for requests on
+                                       a Unix socket, ~/.cmdbox/sock
+
+options:
+  --db PATH    database file, instead of $CMDBOX_DB or ~/.cmdbox/commands.db
+  --version    print the version and exit
+`
+
+// runCLI handles the non-interactive subcommands and returns the exit code
+func runCLI(database *db.DB, args []string) int {
+	switch args[0] {
+	case "run":
+		return cliRun(database, args[1:])
+	case "list":
+		return cliList(database, args[1:])
+	case "export":
+		return cliExport(database, args[1:])
+	case "import":
+		return cliImport(database, args[1:])
+	case "vacuum":
+		return cliVacuum(database)
+	case "import-history":
+		return cliImportHistory(database, args[1:])
+	case "serve":
+		return cliServe(database, args[1:])
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+}
+
+// runResult is what run --json prints once the command finishes
+type runResult struct {
+	Cmd        string `json:"cmd"`
+	ExitCode   int    `json:"exit_code"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// cliRun runs a saved command by name, streaming its output to
+// stdout/stderr, and returns the command's exit code. With --json the
+// output is collected and printed as a runResult at the end instead.
+func cliRun(database *db.DB, args []string) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	args = fs.Args()
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	cmd, err := database.GetByName(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	values := make(map[string]string)
+	for _, arg := range args[1:] {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || key == "" {
+			fmt.Fprintf(os.Stderr, "Error: expected key=value, got %q\n", arg)
+			return 2
+		}
+		values[key] = value
+	}
+
+	params, err := fillParams(*cmd, values)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	cfg := loadConfig()
+	finalCmd := runner.SubstituteParams(runner.StripComments(cmd.Cmd), values)
+	opts := runner.CommandOptions(*cmd, values, runner.RunConfig{
+		Timeout: time.Duration(cfg.DefaultTimeout) * time.Second,
+		Shell:   cfg.DefaultShell,
+	})
+	opts.Lookup = database.GetByName
+
+	database.UpdateLastUsed(cmd.ID)
+	histCmd := runner.SubstituteParams(runner.StripComments(cmd.Cmd), runner.MaskSensitive(params, values))
+
+	// Interactive commands get the terminal, unless the output is wanted
+	// as JSON
+	if cmd.Interactive && !*asJSON {
+		c, err := runner.Interactive(finalCmd, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+		signal.Ignore(os.Interrupt) // ctrl+c is for the command
+		code := 0
+		var exitErr *exec.ExitError
+		if err := c.Run(); errors.As(err, &exitErr) {
+			code = exitErr.ExitCode()
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			code = 1
+		}
+		database.AddHistory(cmd.ID, histCmd, histCmd != finalCmd, code)
+		return code
+	}
+
+	// ctrl+c stops the command's whole process group
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	output := make(chan runner.OutputMsg)
+	go runner.Run(ctx, finalCmd, opts, output)
+
+	result := runResult{Cmd: histCmd}
+	var stdout, stderr []string
+	code := 0
+	for msg := range output {
+		for _, l := range msg.Lines {
+			switch {
+			case *asJSON && l.IsErr:
+				stderr = append(stderr, l.Text)
+			case *asJSON:
+				stdout = append(stdout, l.Text)
+			case l.IsErr:
+				fmt.Fprintln(os.Stderr, l.Text)
+			default:
+				fmt.Println(l.Text)
+			}
+		}
+		if !msg.Done {
+			continue
+		}
+
+		code = msg.ExitCode
+		switch {
+		case msg.Interrupted:
+			code = 130
+		case msg.ErrMsg != "" && *asJSON:
+			result.Error = msg.ErrMsg
+		case msg.ErrMsg != "":
+			fmt.Fprintf(os.Stderr, "Error: %s\n", msg.ErrMsg)
+		}
+		if code < 0 {
+			code = 1
+		}
+
+		database.AddHistory(cmd.ID, histCmd, histCmd != finalCmd, msg.ExitCode)
+		result.ExitCode = code
+		result.DurationMs = msg.Duration.Milliseconds()
+	}
+
+	if *asJSON {
+		result.Stdout = strings.Join(stdout, "\n")
+		result.Stderr = strings.Join(stderr, "\n")
+		// Commands are full of > and &, keep them readable
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(result); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+	return code
+}
+
+// fillParams fills in values for cmd's params from the environment and
+// their defaults, then checks every param has a valid value. It returns
+// cmd's params.
+func fillParams(cmd model.Command, values map[string]string) ([]runner.ParamInfo, error) {
+	params := runner.CommandParams(cmd)
+	var missing []string
+	for _, p := range params {
+		if _, ok := values[p.Name]; !ok {
+			switch env := p.FromEnv(); {
+			case env != "":
+				values[p.Name] = env
+			case p.Default != "":
+				values[p.Name] = p.Default
+			default:
+				missing = append(missing, p.Name)
+				continue
+			}
+		}
+		if err := runner.ValidateParam(p, values[p.Name]); err != nil {
+			return nil, err
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing params: %s", strings.Join(missing, ", "))
+	}
+	return params, nil
+}
+
+// cliList prints command names one per line, or as JSON with --json
+func cliList(database *db.DB, args []string) int {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	tag := fs.String("tag", "", "only list commands with this tag")
+	asJSON := fs.Bool("json", false, "print commands as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var commands []model.Command
+	var err error
+	if *tag != "" {
+		commands, err = database.ListByTag(*tag)
+	} else {
+		commands, err = database.List(db.OrderRecent)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if !*asJSON {
+		for _, c := range commands {
+			fmt.Println(c.Name)
+		}
+		return 0
+	}
+
+	out := make([]db.ExportCommand, 0, len(commands))
+	for _, c := range commands {
+		out = append(out, db.NewExportCommand(c))
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Println(string(data))
+	return 0
+}
+
+// cliExport prints the same JSON backup the TUI's export writes. Query
+// connection passwords are left out unless --include-secrets.
+func cliExport(database *db.DB, args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	includeSecrets := fs.Bool("include-secrets", false, "keep passwords in query connection strings")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	data, stripped, err := database.ExportJSON(*includeSecrets)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Println(string(data))
+	if stripped > 0 {
+		fmt.Fprintf(os.Stderr, "Left the password out of %d connection strings; pass --include-secrets to keep them\n", stripped)
+	}
+	return 0
+}
+
+// cliImport loads an export, doing what --mode says with entries whose
+// name is already taken
+func cliImport(database *db.DB, args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	modeFlag := fs.String("mode", "skip", "for names already taken: skip, overwrite or rename")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	mode, err := db.ParseImportMode(*modeFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	path := fs.Arg(0)
+	var data []byte
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	result, err := database.ImportJSON(data, mode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Imported: %d added, %d overwritten, %d renamed, %d skipped",
+		result.Added, result.Updated, result.Renamed, result.Skipped)
+	if result.Locked > 0 {
+		fmt.Printf(" (%d locked)", result.Locked)
+	}
+	fmt.Println()
+	return 0
+}
+
+// cliVacuum compacts the database and reports how much it shrank
+func cliVacuum(database *db.DB) int {
+	before, err := database.Size()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Fprintln(os.Stderr, "Compacting, this may take a moment on a large database...")
+	if err := database.Vacuum(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	after, err := database.Size()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("%s -> %s\n", formatSize(before), formatSize(after))
+	return 0
+}
+
+// cliImportHistory saves the most used commands from a shell history
+// file, skipping ignored and already saved ones
+func cliImportHistory(database *db.DB, args []string) int {
+	fs := flag.NewFlagSet("import-history", flag.ContinueOnError)
+	shell := fs.String("shell", filepath.Base(os.Getenv("SHELL")), "bash or zsh")
+	limit := fs.Int("limit", 50, "most commands to import")
+	file := fs.String("file", "", "history file, instead of ~/.bash_history or ~/.zsh_history")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *shell != "bash" && *shell != "zsh" {
+		fmt.Fprintf(os.Stderr, "Error: unsupported shell %q, use --shell bash or --shell zsh\n", *shell)
+		return 2
+	}
+
+	cfg := loadConfig()
+
+	path := *file
+	var err error
+	if path == "" {
+		if path, err = historyFile(*shell); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	imported, skipped := 0, 0
+	for _, h := range rankHistory(parseHistory(data, *shell), cfg.HistoryIgnore) {
+		if imported == *limit {
+			break
+		}
+		dup, err := database.IsDuplicateCmd(h.cmd, 0)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		if dup {
+			skipped++
+			continue
+		}
+
+		// Add a counter when the name is taken, e.g. "git log 2"
+		base := historyName(h.cmd)
+		name := base
+		for n := 2; ; n++ {
+			existing, err := database.DuplicateName(name, 0)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return 1
+			}
+			if existing == "" {
+				break
+			}
+			name = fmt.Sprintf("%s %d", base, n)
+		}
+
+		if _, err := database.Add(model.Command{Name: name, Cmd: h.cmd}); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		imported++
+	}
+
+	fmt.Printf("Imported %d commands from %s", imported, path)
+	if skipped > 0 {
+		fmt.Printf(", skipped %d already saved", skipped)
+	}
+	fmt.Println()
+	return 0
+}
+
+// loadConfig reads config.toml, warning on stderr and falling back to the
+// defaults if it can't be read
+func loadConfig() config.Config {
+	cfg, _, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring config.toml: %v\n", err)
+	}
+	return cfg
+}
+
+// formatSize renders a byte count like "1.5 MB"
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGT"[exp])
+}
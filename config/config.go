@@ -0,0 +1,136 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Config is read from ~/.cmdbox/config.toml. Anything left out keeps its default.
+type Config struct {
+	// EncryptSecrets remembers sensitive param values, encrypted with a
+	// passphrase asked for at startup
+	EncryptSecrets bool `toml:"encrypt_secrets"`
+
+	// MaxOutputLines caps how much command output is kept; older lines
+	// are dropped
+	MaxOutputLines int `toml:"max_output_lines"`
+
+	// HistoryIgnore lists commands import-history skips, matched against
+	// the first word of each history line
+	HistoryIgnore []string `toml:"history_ignore"`
+
+	// RecentCommands is how many recently used commands are pinned above
+	// the list; 0 turns the section off
+	RecentCommands int `toml:"recent_commands"`
+
+	// DefaultTimeout is the timeout in seconds of commands that don't set
+	// one; 0 means none
+	DefaultTimeout int `toml:"default_timeout"`
+
+	// DefaultShell runs commands that don't set a shell; empty uses $SHELL
+	DefaultShell string `toml:"default_shell"`
+
+	// QueryPreviewLimit caps the rows a SELECT loads when run from the
+	// list, unless it has its own LIMIT; 0 loads them all
+	QueryPreviewLimit int `toml:"query_preview_limit"`
+
+	// BatchOnFailure is what a batch of marked commands does when one
+	// fails: "ask", "stop" or "continue"
+	BatchOnFailure string `toml:"batch_on_failure"`
+
+	Keys KeyMap `toml:"keys"`
+}
+
+// KeyMap maps actions to keys, using Bubble Tea key names like "A" or "ctrl+e"
+type KeyMap struct {
+	Add    string `toml:"add"`
+	Edit   string `toml:"edit"`
+	Delete string `toml:"delete"`
+	Run    string `toml:"run"`
+	Yank   string `toml:"yank"`
+	Quit   string `toml:"quit"`
+}
+
+// Default returns the built-in configuration
+func Default() Config {
+	return Config{
+		MaxOutputLines:    10000,
+		HistoryIgnore:     []string{"ls", "ll", "cd", "pwd", "clear", "exit", "history", "cmdbox"},
+		RecentCommands:    3,
+		BatchOnFailure:    "ask",
+		QueryPreviewLimit: 1000,
+		Keys: KeyMap{
+			Add:    "A",
+			Edit:   "E",
+			Delete: "D",
+			Run:    "enter",
+			Yank:   "Y",
+			Quit:   "Q",
+		},
+	}
+}
+
+// Dir returns the cmdbox data directory (~/.cmdbox), creating it if needed
+func Dir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(home, ".cmdbox")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// Load reads the config file over the defaults. A missing file is not an
+// error. Unknown keys don't fail the load; they come back as warnings.
+func Load() (Config, []string, error) {
+	cfg := Default()
+
+	dir, err := Dir()
+	if err != nil {
+		return cfg, nil, err
+	}
+
+	md, err := toml.DecodeFile(filepath.Join(dir, "config.toml"), &cfg)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil, nil
+	}
+	if err != nil {
+		return Default(), nil, err
+	}
+
+	var warnings []string
+	for _, key := range md.Undecoded() {
+		warnings = append(warnings, fmt.Sprintf("config.toml: unknown key %q", key.String()))
+	}
+	if cfg.MaxOutputLines < 1 {
+		warnings = append(warnings, fmt.Sprintf("config.toml: max_output_lines must be at least 1, using %d", Default().MaxOutputLines))
+		cfg.MaxOutputLines = Default().MaxOutputLines
+	}
+	if cfg.DefaultTimeout < 0 {
+		warnings = append(warnings, "config.toml: default_timeout can't be negative, using no timeout")
+		cfg.DefaultTimeout = 0
+	}
+	if cfg.RecentCommands < 0 {
+		warnings = append(warnings, fmt.Sprintf("config.toml: recent_commands can't be negative, using %d", Default().RecentCommands))
+		cfg.RecentCommands = Default().RecentCommands
+	}
+	if cfg.QueryPreviewLimit < 0 {
+		warnings = append(warnings, fmt.Sprintf("config.toml: query_preview_limit can't be negative, using %d", Default().QueryPreviewLimit))
+		cfg.QueryPreviewLimit = Default().QueryPreviewLimit
+	}
+	switch cfg.BatchOnFailure {
+	case "ask", "stop", "continue":
+	default:
+		warnings = append(warnings, fmt.Sprintf("config.toml: batch_on_failure must be ask, stop or continue, using %q", Default().BatchOnFailure))
+		cfg.BatchOnFailure = Default().BatchOnFailure
+	}
+	return cfg, warnings, nil
+}
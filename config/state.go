@@ -0,0 +1,51 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// State is where the app was left on quit, kept in ~/.cmdbox/state.json
+type State struct {
+	Tab    string `json:"tab"`
+	Cursor int    `json:"cursor"`
+}
+
+// LoadState reads the state saved by the last session. A missing file
+// gives the zero State.
+func LoadState() (State, error) {
+	var s State
+
+	dir, err := Dir()
+	if err != nil {
+		return s, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "state.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return State{}, err
+	}
+	return s, nil
+}
+
+// SaveState writes s for the next session to restore
+func SaveState(s State) error {
+	dir, err := Dir()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "state.json"), data, 0644)
+}
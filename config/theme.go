@@ -0,0 +1,117 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Theme maps the UI's semantic colors to lipgloss color strings: an ANSI
+// 256 color number like "99" or a hex color like "#7d56f4".
+type Theme struct {
+	Name      string `toml:"name"`
+	Primary   string `toml:"primary"`
+	Secondary string `toml:"secondary"`
+	Accent    string `toml:"accent"`
+	Danger    string `toml:"danger"`
+}
+
+// Themes are the built-in themes, selectable by name in theme.toml
+var Themes = map[string]Theme{
+	"default": {
+		Name:      "default",
+		Primary:   "99",  // purple
+		Secondary: "240", // gray
+		Accent:    "86",  // green
+		Danger:    "196", // red
+	},
+	"solarized": {
+		Name:      "solarized",
+		Primary:   "#268bd2",
+		Secondary: "#586e75",
+		Accent:    "#859900",
+		Danger:    "#dc322f",
+	},
+	"mono": {
+		Name:      "mono",
+		Primary:   "255",
+		Secondary: "240",
+		Accent:    "252",
+		Danger:    "250",
+	},
+}
+
+var hexColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// LoadTheme reads ~/.cmdbox/theme.toml. The file can pick a built-in theme
+// with name and override any of its colors. A missing file gives the
+// default theme; an invalid one gives the default theme and an error.
+func LoadTheme() (Theme, error) {
+	dir, err := Dir()
+	if err != nil {
+		return Themes["default"], err
+	}
+
+	var file Theme
+	_, err = toml.DecodeFile(filepath.Join(dir, "theme.toml"), &file)
+	if errors.Is(err, os.ErrNotExist) {
+		return Themes["default"], nil
+	}
+	if err != nil {
+		return Themes["default"], err
+	}
+
+	name := file.Name
+	if name == "" {
+		name = "default"
+	}
+	theme, ok := Themes[name]
+	if !ok {
+		return Themes["default"], fmt.Errorf("theme.toml: unknown theme %q (available: %s)", name, strings.Join(themeNames(), ", "))
+	}
+
+	for _, c := range []struct {
+		key   string
+		value string
+		dst   *string
+	}{
+		{"primary", file.Primary, &theme.Primary},
+		{"secondary", file.Secondary, &theme.Secondary},
+		{"accent", file.Accent, &theme.Accent},
+		{"danger", file.Danger, &theme.Danger},
+	} {
+		if c.value == "" {
+			continue
+		}
+		if !validColor(c.value) {
+			return Themes["default"], fmt.Errorf("theme.toml: invalid color %q for %s", c.value, c.key)
+		}
+		*c.dst = c.value
+	}
+	return theme, nil
+}
+
+// validColor reports whether s is an ANSI color number (0-255) or a hex color
+func validColor(s string) bool {
+	if hexColor.MatchString(s) {
+		return true
+	}
+	n, err := strconv.Atoi(s)
+	return err == nil && n >= 0 && n <= 255
+}
+
+func themeNames() []string {
+	names := make([]string, 0, len(Themes))
+	for name := range Themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -3,11 +3,14 @@ package db
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"cmdbox/config"
 	"cmdbox/model"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -17,76 +20,237 @@ type DB struct {
 	conn *sql.DB
 }
 
+// DefaultPath is where the database lives unless told otherwise: $CMDBOX_DB
+// if it's set, otherwise ~/.cmdbox/commands.db
+func DefaultPath() (string, error) {
+	if path := os.Getenv("CMDBOX_DB"); path != "" {
+		return path, nil
+	}
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "commands.db"), nil
+}
+
+// New opens the database at DefaultPath
 func New() (*DB, error) {
-	home, err := os.UserHomeDir()
+	path, err := DefaultPath()
 	if err != nil {
 		return nil, err
 	}
+	return NewWithPath(path)
+}
 
-	dir := filepath.Join(home, ".cmdbox")
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return nil, err
+// NewWithPath opens the database at path, creating it and its parent
+// directories if needed. ":memory:" gives a fresh database that goes away
+// when it's closed. Errors the user can fix wrap ErrCorrupt, ErrReadOnly,
+// ErrPermission or ErrDiskFull.
+func NewWithPath(path string) (*DB, error) {
+	memory := path == ":memory:"
+	if !memory {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, classifyError(err)
+		}
 	}
 
-	dbPath := filepath.Join(dir, "commands.db")
-	conn, err := sql.Open("sqlite3", dbPath)
+	conn, err := sql.Open("sqlite3", path)
 	if err != nil {
-		return nil, err
+		return nil, classifyError(err)
+	}
+	if memory {
+		// Each connection would otherwise get its own empty database
+		conn.SetMaxOpenConns(1)
 	}
 
 	db := &DB{conn: conn}
 	if err := db.migrate(); err != nil {
-		return nil, err
+		conn.Close()
+		return nil, classifyError(err)
 	}
 
 	return db, nil
 }
 
-func (d *DB) migrate() error {
-	_, err := d.conn.Exec(`
-		CREATE TABLE IF NOT EXISTS commands (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT NOT NULL,
-			cmd TEXT NOT NULL,
-			description TEXT DEFAULT '',
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			last_used_at DATETIME
-		);
-		CREATE INDEX IF NOT EXISTS idx_commands_name ON commands(name);
-		CREATE INDEX IF NOT EXISTS idx_commands_cmd ON commands(cmd);
-	`)
-	if err != nil {
-		return err
+func (d *DB) Close() error {
+	return d.conn.Close()
+}
+
+// Vacuum rebuilds the database file to give back space left by deleted
+// rows. It can take a while on a large database.
+func (d *DB) Vacuum() error {
+	_, err := d.conn.Exec(`VACUUM`)
+	return err
+}
+
+// Size returns the size of the database in bytes
+func (d *DB) Size() (int64, error) {
+	var pages, pageSize int64
+	if err := d.conn.QueryRow(`PRAGMA page_count`).Scan(&pages); err != nil {
+		return 0, err
 	}
+	if err := d.conn.QueryRow(`PRAGMA page_size`).Scan(&pageSize); err != nil {
+		return 0, err
+	}
+	return pages * pageSize, nil
+}
 
-	// Add last_params column if not exists
-	d.conn.Exec(`ALTER TABLE commands ADD COLUMN last_params TEXT DEFAULT ''`)
-
-	// SQL queries table
-	_, err = d.conn.Exec(`
-		CREATE TABLE IF NOT EXISTS queries (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT NOT NULL,
-			sql TEXT NOT NULL,
-			description TEXT DEFAULT '',
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			last_used_at DATETIME
-		);
-		CREATE INDEX IF NOT EXISTS idx_queries_name ON queries(name);
-	`)
+const commandColumns = `id, name, cmd, description, created_at, last_used_at, COALESCE(last_params, ''),
+	COALESCE(timeout_secs, 0), COALESCE(tags, ''), COALESCE(shell, ''), COALESCE(use_count, 0),
+	COALESCE(work_dir, ''), COALESCE(env, ''), COALESCE(category, ''), COALESCE(archived, 0), COALESCE(label, ''),
+	COALESCE(interactive, 0), COALESCE(locked, 0)`
+
+// Order selects how List sorts commands
+type Order int
+
+const (
+	OrderRecent  Order = iota // last used, then created
+	OrderUsage                // most used, then last used
+	OrderName                 // name A-Z, ignoring case
+	OrderCreated              // newest first
+	OrderManual               // as arranged with Swap
+)
+
+// String names the order for display, e.g. "most used"
+func (o Order) String() string {
+	switch o {
+	case OrderUsage:
+		return "most used"
+	case OrderName:
+		return "name"
+	case OrderCreated:
+		return "created"
+	case OrderManual:
+		return "manual"
+	default:
+		return "recent"
+	}
+}
+
+// Next returns the order after o, wrapping around
+func (o Order) Next() Order {
+	return (o + 1) % (OrderManual + 1)
+}
+
+// clause is the ORDER BY for o. Each ends with id so ties keep a stable
+// order.
+func (o Order) clause() string {
+	switch o {
+	case OrderUsage:
+		return `use_count DESC, last_used_at DESC NULLS LAST, created_at DESC, id DESC`
+	case OrderName:
+		return `name COLLATE NOCASE, id`
+	case OrderCreated:
+		return `created_at DESC, id DESC`
+	case OrderManual:
+		return `sort_order, id`
+	default:
+		return `last_used_at DESC NULLS LAST, created_at DESC, id DESC`
+	}
+}
+
+// List returns the commands that aren't archived
+func (d *DB) List(order Order) ([]model.Command, error) {
+	return d.queryCommands(`
+		SELECT ` + commandColumns + `
+		FROM commands
+		WHERE COALESCE(archived, 0) = 0
+		ORDER BY ` + order.clause())
+}
+
+// ListRecent returns up to limit unarchived commands that have been run,
+// most recently used first
+func (d *DB) ListRecent(limit int) ([]model.Command, error) {
+	return d.queryCommands(`
+		SELECT `+commandColumns+`
+		FROM commands
+		WHERE last_used_at IS NOT NULL AND COALESCE(archived, 0) = 0
+		ORDER BY last_used_at DESC, id DESC
+		LIMIT ?
+	`, limit)
+}
+
+// ListArchived returns the archived commands that List leaves out
+func (d *DB) ListArchived(order Order) ([]model.Command, error) {
+	return d.queryCommands(`
+		SELECT ` + commandColumns + `
+		FROM commands
+		WHERE archived = 1
+		ORDER BY ` + order.clause())
+}
+
+// ListByTag returns unarchived commands carrying the given tag
+func (d *DB) ListByTag(tag string) ([]model.Command, error) {
+	return d.queryCommands(`
+		SELECT `+commandColumns+`
+		FROM commands
+		WHERE instr(',' || tags || ',', ?) > 0 AND COALESCE(archived, 0) = 0
+		ORDER BY last_used_at DESC NULLS LAST, created_at DESC
+	`, ","+strings.ToLower(strings.TrimSpace(tag))+",")
+}
+
+// SetArchived archives a command, hiding it from List, or restores it
+func (d *DB) SetArchived(id int64, archived bool) error {
+	_, err := d.conn.Exec(`UPDATE commands SET archived = ? WHERE id = ?`, archived, id)
 	return err
 }
 
-func (d *DB) Close() error {
-	return d.conn.Close()
+// SetLocked locks a command against editing and deleting, or unlocks it
+// ErrLocked is returned when changing or deleting a locked command
+var ErrLocked = errors.New("command is locked")
+
+func (d *DB) SetLocked(id int64, locked bool) error {
+	_, err := d.conn.Exec(`UPDATE commands SET locked = ? WHERE id = ?`, locked, id)
+	return err
 }
 
-func (d *DB) List() ([]model.Command, error) {
+// ListCategories returns the distinct categories in use by archived or
+// unarchived commands, sorted
+func (d *DB) ListCategories(archived bool) ([]string, error) {
 	rows, err := d.conn.Query(`
-		SELECT id, name, cmd, description, created_at, last_used_at, COALESCE(last_params, '')
+		SELECT DISTINCT category FROM commands
+		WHERE category IS NOT NULL AND category != '' AND COALESCE(archived, 0) = ?
+		ORDER BY category
+	`, archived)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []string
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
+
+// GetByName returns the command with exactly this name. It fails if no
+// command or more than one command has the name.
+func (d *DB) GetByName(name string) (*model.Command, error) {
+	commands, err := d.queryCommands(`
+		SELECT `+commandColumns+`
 		FROM commands
-		ORDER BY last_used_at DESC NULLS LAST, created_at DESC
-	`)
+		WHERE TRIM(name) = ?
+	`, strings.TrimSpace(name))
+	if err != nil {
+		return nil, err
+	}
+	switch len(commands) {
+	case 0:
+		return nil, fmt.Errorf("no command named %q", name)
+	case 1:
+		return &commands[0], nil
+	default:
+		return nil, fmt.Errorf("%d commands are named %q; rename one to run it by name", len(commands), name)
+	}
+}
+
+func (d *DB) queryCommands(query string, args ...any) ([]model.Command, error) {
+	rows, err := d.conn.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -96,7 +260,7 @@ func (d *DB) List() ([]model.Command, error) {
 	for rows.Next() {
 		var c model.Command
 		var lastUsed sql.NullTime
-		if err := rows.Scan(&c.ID, &c.Name, &c.Cmd, &c.Description, &c.CreatedAt, &lastUsed, &c.LastParams); err != nil {
+		if err := rows.Scan(&c.ID, &c.Name, &c.Cmd, &c.Description, &c.CreatedAt, &lastUsed, &c.LastParams, &c.TimeoutSecs, &c.Tags, &c.Shell, &c.UseCount, &c.WorkDir, &c.Env, &c.Category, &c.Archived, &c.Label, &c.Interactive, &c.Locked); err != nil {
 			return nil, err
 		}
 		if lastUsed.Valid {
@@ -107,10 +271,22 @@ func (d *DB) List() ([]model.Command, error) {
 	return commands, rows.Err()
 }
 
-func (d *DB) Add(name, cmd, description string) (int64, error) {
-	result, err := d.conn.Exec(
-		`INSERT INTO commands (name, cmd, description) VALUES (?, ?, ?)`,
-		name, cmd, description,
+// execer runs statements and queries, on the database or inside a
+// transaction
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func (d *DB) Add(c model.Command) (int64, error) {
+	return addCommand(d.conn, c)
+}
+
+func addCommand(ex execer, c model.Command) (int64, error) {
+	result, err := ex.Exec(
+		`INSERT INTO commands (name, cmd, description, timeout_secs, tags, shell, work_dir, env, category, label, interactive, sort_order)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, (SELECT COALESCE(MAX(sort_order), 0) + 1 FROM commands))`,
+		c.Name, c.Cmd, c.Description, c.TimeoutSecs, c.Tags, c.Shell, c.WorkDir, c.Env, c.Category, c.Label, c.Interactive,
 	)
 	if err != nil {
 		return 0, err
@@ -118,47 +294,101 @@ func (d *DB) Add(name, cmd, description string) (int64, error) {
 	return result.LastInsertId()
 }
 
-func (d *DB) Update(id int64, name, cmd, description string) error {
-	_, err := d.conn.Exec(
-		`UPDATE commands SET name = ?, cmd = ?, description = ? WHERE id = ?`,
-		name, cmd, description, id,
+func (d *DB) Update(c model.Command) error {
+	return updateCommand(d.conn, c)
+}
+
+func updateCommand(ex execer, c model.Command) error {
+	if err := checkUnlocked(ex, c.ID); err != nil {
+		return err
+	}
+	_, err := ex.Exec(
+		`UPDATE commands SET name = ?, cmd = ?, description = ?, timeout_secs = ?, tags = ?, shell = ?,
+			work_dir = ?, env = ?, category = ?, label = ?, interactive = ?
+		WHERE id = ?`,
+		c.Name, c.Cmd, c.Description, c.TimeoutSecs, c.Tags, c.Shell, c.WorkDir, c.Env, c.Category, c.Label, c.Interactive, c.ID,
 	)
 	return err
 }
 
+// checkUnlocked returns ErrLocked if the command with id is locked
+func checkUnlocked(ex execer, id int64) error {
+	var locked bool
+	err := ex.QueryRow(`SELECT COALESCE(locked, 0) FROM commands WHERE id = ?`, id).Scan(&locked)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil
+	case err != nil:
+		return err
+	case locked:
+		return ErrLocked
+	}
+	return nil
+}
+
+// Swap exchanges the manual sort positions of two commands
+func (d *DB) Swap(idA, idB int64) error {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var orderA, orderB int64
+	if err := tx.QueryRow(`SELECT COALESCE(sort_order, 0) FROM commands WHERE id = ?`, idA).Scan(&orderA); err != nil {
+		return err
+	}
+	if err := tx.QueryRow(`SELECT COALESCE(sort_order, 0) FROM commands WHERE id = ?`, idB).Scan(&orderB); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE commands SET sort_order = ? WHERE id = ?`, orderB, idA); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE commands SET sort_order = ? WHERE id = ?`, orderA, idB); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 func (d *DB) Delete(id int64) error {
+	if err := checkUnlocked(d.conn, id); err != nil {
+		return err
+	}
 	_, err := d.conn.Exec(`DELETE FROM commands WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	_, err = d.conn.Exec(`DELETE FROM param_history WHERE command_id = ?`, id)
 	return err
 }
 
+// UpdateLastUsed stamps the command as just run and bumps its use count
 func (d *DB) UpdateLastUsed(id int64) error {
 	_, err := d.conn.Exec(
-		`UPDATE commands SET last_used_at = ? WHERE id = ?`,
+		`UPDATE commands SET last_used_at = ?, use_count = COALESCE(use_count, 0) + 1 WHERE id = ?`,
 		time.Now(), id,
 	)
 	return err
 }
 
-// IsDuplicateCmd checks if a command with the same cmd string exists
+// IsDuplicateCmd checks if a command with the same cmd string exists,
+// ignoring differences in whitespace
 func (d *DB) IsDuplicateCmd(cmd string, excludeID int64) (bool, error) {
-	normalized := strings.TrimSpace(cmd)
-	var count int
-	err := d.conn.QueryRow(
-		`SELECT COUNT(*) FROM commands WHERE TRIM(cmd) = ? AND id != ?`,
-		normalized, excludeID,
-	).Scan(&count)
-	return count > 0, err
+	return d.containsNormalized(cmd, `SELECT cmd FROM commands WHERE id != ?`, excludeID)
 }
 
-// IsDuplicateName checks if a command with the same name exists
-func (d *DB) IsDuplicateName(name string, excludeID int64) (bool, error) {
-	normalized := strings.TrimSpace(name)
-	var count int
+// DuplicateName returns the name of another command whose name matches name,
+// ignoring case and surrounding spaces, or "" if there is none
+func (d *DB) DuplicateName(name string, excludeID int64) (string, error) {
+	var existing string
 	err := d.conn.QueryRow(
-		`SELECT COUNT(*) FROM commands WHERE TRIM(name) = ? AND id != ?`,
-		normalized, excludeID,
-	).Scan(&count)
-	return count > 0, err
+		`SELECT name FROM commands WHERE LOWER(TRIM(name)) = LOWER(?) AND id != ? LIMIT 1`,
+		strings.TrimSpace(name), excludeID,
+	).Scan(&existing)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return existing, err
 }
 
 // SaveLastParams saves param values as JSON (caller should filter sensitive params)
@@ -171,11 +401,67 @@ func (d *DB) SaveLastParams(id int64, params map[string]string) error {
 	return err
 }
 
+// paramHistoryLimit is how many distinct values are kept for each param
+const paramHistoryLimit = 10
+
+// AddParamHistory records params as the command's most recently used
+// values. Empty values are skipped, and only the newest paramHistoryLimit
+// distinct values of each param are kept.
+func (d *DB) AddParamHistory(commandID int64, params map[string]string) error {
+	now := time.Now()
+	for param, value := range params {
+		if value == "" {
+			continue
+		}
+		_, err := d.conn.Exec(
+			`INSERT OR REPLACE INTO param_history (command_id, param, value, used_at) VALUES (?, ?, ?, ?)`,
+			commandID, param, value, now,
+		)
+		if err != nil {
+			return err
+		}
+		_, err = d.conn.Exec(`
+			DELETE FROM param_history WHERE command_id = ? AND param = ? AND value NOT IN (
+				SELECT value FROM param_history WHERE command_id = ? AND param = ?
+				ORDER BY used_at DESC LIMIT ?
+			)`,
+			commandID, param, commandID, param, paramHistoryLimit,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParamHistory returns the recent values of each of a command's params,
+// newest first
+func (d *DB) ParamHistory(commandID int64) (map[string][]string, error) {
+	rows, err := d.conn.Query(
+		`SELECT param, value FROM param_history WHERE command_id = ? ORDER BY used_at DESC`,
+		commandID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make(map[string][]string)
+	for rows.Next() {
+		var param, value string
+		if err := rows.Scan(&param, &value); err != nil {
+			return nil, err
+		}
+		history[param] = append(history[param], value)
+	}
+	return history, rows.Err()
+}
+
 // Query methods
 
 func (d *DB) ListQueries() ([]model.Query, error) {
 	rows, err := d.conn.Query(`
-		SELECT id, name, sql, description, created_at, last_used_at
+		SELECT id, name, sql, description, created_at, last_used_at, COALESCE(conn_string, '')
 		FROM queries
 		ORDER BY last_used_at DESC NULLS LAST, created_at DESC
 	`)
@@ -188,7 +474,7 @@ func (d *DB) ListQueries() ([]model.Query, error) {
 	for rows.Next() {
 		var q model.Query
 		var lastUsed sql.NullTime
-		if err := rows.Scan(&q.ID, &q.Name, &q.SQL, &q.Description, &q.CreatedAt, &lastUsed); err != nil {
+		if err := rows.Scan(&q.ID, &q.Name, &q.SQL, &q.Description, &q.CreatedAt, &lastUsed, &q.ConnString); err != nil {
 			return nil, err
 		}
 		if lastUsed.Valid {
@@ -199,10 +485,14 @@ func (d *DB) ListQueries() ([]model.Query, error) {
 	return queries, rows.Err()
 }
 
-func (d *DB) AddQuery(name, sql, description string) (int64, error) {
-	result, err := d.conn.Exec(
-		`INSERT INTO queries (name, sql, description) VALUES (?, ?, ?)`,
-		name, sql, description,
+func (d *DB) AddQuery(q model.Query) (int64, error) {
+	return addQuery(d.conn, q)
+}
+
+func addQuery(ex execer, q model.Query) (int64, error) {
+	result, err := ex.Exec(
+		`INSERT INTO queries (name, sql, description, conn_string) VALUES (?, ?, ?, ?)`,
+		q.Name, q.SQL, q.Description, q.ConnString,
 	)
 	if err != nil {
 		return 0, err
@@ -210,10 +500,14 @@ func (d *DB) AddQuery(name, sql, description string) (int64, error) {
 	return result.LastInsertId()
 }
 
-func (d *DB) UpdateQuery(id int64, name, sql, description string) error {
-	_, err := d.conn.Exec(
-		`UPDATE queries SET name = ?, sql = ?, description = ? WHERE id = ?`,
-		name, sql, description, id,
+func (d *DB) UpdateQuery(q model.Query) error {
+	return updateQuery(d.conn, q)
+}
+
+func updateQuery(ex execer, q model.Query) error {
+	_, err := ex.Exec(
+		`UPDATE queries SET name = ?, sql = ?, description = ?, conn_string = ? WHERE id = ?`,
+		q.Name, q.SQL, q.Description, q.ConnString, q.ID,
 	)
 	return err
 }
@@ -231,22 +525,105 @@ func (d *DB) UpdateQueryLastUsed(id int64) error {
 	return err
 }
 
-func (d *DB) IsDuplicateQueryName(name string, excludeID int64) (bool, error) {
-	normalized := strings.TrimSpace(name)
-	var count int
+// DuplicateQueryName returns the name of another query whose name matches name,
+// ignoring case and surrounding spaces, or "" if there is none
+func (d *DB) DuplicateQueryName(name string, excludeID int64) (string, error) {
+	var existing string
 	err := d.conn.QueryRow(
-		`SELECT COUNT(*) FROM queries WHERE TRIM(name) = ? AND id != ?`,
-		normalized, excludeID,
-	).Scan(&count)
-	return count > 0, err
+		`SELECT name FROM queries WHERE LOWER(TRIM(name)) = LOWER(?) AND id != ? LIMIT 1`,
+		strings.TrimSpace(name), excludeID,
+	).Scan(&existing)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return existing, err
 }
 
+// IsDuplicateQuerySQL checks if a query with the same SQL exists, ignoring
+// differences in whitespace
 func (d *DB) IsDuplicateQuerySQL(sql string, excludeID int64) (bool, error) {
-	normalized := strings.TrimSpace(sql)
-	var count int
-	err := d.conn.QueryRow(
-		`SELECT COUNT(*) FROM queries WHERE TRIM(sql) = ? AND id != ?`,
-		normalized, excludeID,
-	).Scan(&count)
-	return count > 0, err
+	return d.containsNormalized(sql, `SELECT sql FROM queries WHERE id != ?`, excludeID)
+}
+
+// containsNormalized reports whether any value selected by query matches s
+// once both have their whitespace normalized. Only the comparison is
+// normalized; stored values keep their spacing.
+func (d *DB) containsNormalized(s, query string, args ...any) (bool, error) {
+	rows, err := d.conn.Query(query, args...)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	want := normalizeWhitespace(s)
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return false, err
+		}
+		if normalizeWhitespace(v) == want {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// normalizeWhitespace trims s and collapses each run of whitespace inside
+// it, newlines included, to a single space
+func normalizeWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// History methods
+
+// AddHistory records a finished run. finalCmd should already have
+// sensitive values masked, and redacted says whether any were.
+func (d *DB) AddHistory(commandID int64, finalCmd string, redacted bool, exitCode int) error {
+	_, err := d.conn.Exec(
+		`INSERT INTO history (command_id, final_cmd, redacted, exit_code, ran_at) VALUES (?, ?, ?, ?, ?)`,
+		commandID, finalCmd, redacted, exitCode, time.Now(),
+	)
+	return err
+}
+
+// ListHistory returns the most recent runs, newest first
+func (d *DB) ListHistory(limit int) ([]model.HistoryEntry, error) {
+	rows, err := d.conn.Query(`
+		SELECT h.id, COALESCE(h.command_id, 0), COALESCE(c.name, ''), h.final_cmd,
+			COALESCE(h.redacted, 0), COALESCE(h.exit_code, -1), h.ran_at
+		FROM history h
+		LEFT JOIN commands c ON c.id = h.command_id
+		ORDER BY h.ran_at DESC, h.id DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []model.HistoryEntry
+	for rows.Next() {
+		var h model.HistoryEntry
+		if err := rows.Scan(&h.ID, &h.CommandID, &h.CommandName, &h.FinalCmd, &h.Redacted, &h.ExitCode, &h.RanAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, h)
+	}
+	return entries, rows.Err()
+}
+
+// Setting returns a stored setting, or "" if it isn't set
+func (d *DB) Setting(key string) (string, error) {
+	var value string
+	err := d.conn.QueryRow(`SELECT value FROM settings WHERE key = ?`, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return value, err
+}
+
+// SetSetting stores a setting, replacing any previous value
+func (d *DB) SetSetting(key, value string) error {
+	_, err := d.conn.Exec(`INSERT OR REPLACE INTO settings (key, value) VALUES (?, ?)`, key, value)
+	return err
 }
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Errors opening the database that the user can do something about.
+// NewWithPath wraps the underlying error with one of these.
+var (
+	ErrCorrupt    = errors.New("database file is damaged")
+	ErrReadOnly   = errors.New("database is read-only")
+	ErrPermission = errors.New("no permission to open the database")
+	ErrDiskFull   = errors.New("disk is full")
+)
+
+// classifyError wraps err with the sentinel matching its cause, if any
+func classifyError(err error) error {
+	var sentinel error
+	var sqliteErr sqlite3.Error
+	switch {
+	case errors.As(err, &sqliteErr):
+		switch sqliteErr.Code {
+		case sqlite3.ErrCorrupt, sqlite3.ErrNotADB:
+			sentinel = ErrCorrupt
+		case sqlite3.ErrReadonly:
+			sentinel = ErrReadOnly
+		case sqlite3.ErrPerm, sqlite3.ErrCantOpen:
+			sentinel = ErrPermission
+		case sqlite3.ErrFull:
+			sentinel = ErrDiskFull
+		}
+	case errors.Is(err, os.ErrPermission):
+		sentinel = ErrPermission
+	case errors.Is(err, syscall.ENOSPC):
+		sentinel = ErrDiskFull
+	case errors.Is(err, syscall.EROFS):
+		sentinel = ErrReadOnly
+	}
+	if sentinel == nil {
+		return err
+	}
+	return fmt.Errorf("%w: %w", sentinel, err)
+}
+
+// BackupCorrupt moves a damaged database at path aside, along with its
+// journal files, so a fresh one can be created there. It returns where
+// the database was moved to.
+func BackupCorrupt(path string) (string, error) {
+	backup := path + ".corrupt-" + time.Now().Format("20060102-150405")
+	if err := os.Rename(path, backup); err != nil {
+		return "", err
+	}
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		if _, err := os.Stat(path + suffix); err == nil {
+			os.Rename(path+suffix, backup+suffix)
+		}
+	}
+	return backup, nil
+}
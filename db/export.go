@@ -0,0 +1,158 @@
+package db
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+
+	"cmdbox/model"
+)
+
+// ExportVersion is the format version written by ExportJSON
+const ExportVersion = 1
+
+// Export is the JSON envelope written by ExportJSON
+type Export struct {
+	Version  int             `json:"version"`
+	Commands []ExportCommand `json:"commands"`
+	Queries  []ExportQuery   `json:"queries"`
+}
+
+// ExportCommand is a command as stored in an export. Last-used param
+// values are left out since they may hold sensitive data.
+type ExportCommand struct {
+	Name        string     `json:"name"`
+	Cmd         string     `json:"cmd"`
+	Description string     `json:"description"`
+	Tags        []string   `json:"tags"`
+	TimeoutSecs int        `json:"timeout_secs"`
+	Shell       string     `json:"shell"`
+	UseCount    int        `json:"use_count"`
+	WorkDir     string     `json:"work_dir"`
+	Env         string     `json:"env"`
+	Category    string     `json:"category"`
+	Label       string     `json:"label"`
+	Interactive bool       `json:"interactive"`
+	Archived    bool       `json:"archived"`
+	Locked      bool       `json:"locked"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+}
+
+// NewExportCommand converts a stored command to its export form
+func NewExportCommand(c model.Command) ExportCommand {
+	tags := c.TagList()
+	if tags == nil {
+		tags = []string{}
+	}
+	return ExportCommand{
+		Name:        c.Name,
+		Cmd:         c.Cmd,
+		Description: c.Description,
+		Tags:        tags,
+		TimeoutSecs: c.TimeoutSecs,
+		Shell:       c.Shell,
+		UseCount:    c.UseCount,
+		WorkDir:     c.WorkDir,
+		Env:         c.Env,
+		Category:    c.Category,
+		Label:       c.Label,
+		Interactive: c.Interactive,
+		Archived:    c.Archived,
+		Locked:      c.Locked,
+		CreatedAt:   c.CreatedAt,
+		LastUsedAt:  c.LastUsedAt,
+	}
+}
+
+// ExportQuery is a SQL query as stored in an export
+type ExportQuery struct {
+	Name        string     `json:"name"`
+	SQL         string     `json:"sql"`
+	Description string     `json:"description"`
+	ConnString  string     `json:"conn_string"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+}
+
+// ExportJSON serializes all commands and queries into a versioned envelope.
+// Unless includeSecrets, passwords are taken out of query connection
+// strings; stripped counts the ones that had any.
+func (d *DB) ExportJSON(includeSecrets bool) (data []byte, stripped int, err error) {
+	commands, err := d.List(OrderRecent)
+	if err != nil {
+		return nil, 0, err
+	}
+	archived, err := d.ListArchived(OrderRecent)
+	if err != nil {
+		return nil, 0, err
+	}
+	commands = append(commands, archived...)
+	queries, err := d.ListQueries()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	export := Export{
+		Version:  ExportVersion,
+		Commands: make([]ExportCommand, 0, len(commands)),
+		Queries:  make([]ExportQuery, 0, len(queries)),
+	}
+	for _, c := range commands {
+		export.Commands = append(export.Commands, NewExportCommand(c))
+	}
+	for _, q := range queries {
+		conn := q.ConnString
+		if !includeSecrets {
+			conn = stripCredentials(conn)
+			if conn != q.ConnString {
+				stripped++
+			}
+		}
+		export.Queries = append(export.Queries, ExportQuery{
+			Name:        q.Name,
+			SQL:         q.SQL,
+			Description: q.Description,
+			ConnString:  conn,
+			CreatedAt:   q.CreatedAt,
+			LastUsedAt:  q.LastUsedAt,
+		})
+	}
+
+	data, err = json.MarshalIndent(export, "", "  ")
+	return data, stripped, err
+}
+
+// passwordParams are connection string query parameters holding secrets
+var passwordParams = map[string]bool{"password": true, "passwd": true, "sslpassword": true}
+
+// stripCredentials takes the password out of a connection URL, keeping the
+// user, host and database so it still says where it connects. A string
+// that doesn't parse as a URL can't be checked, so it's dropped.
+func stripCredentials(connStr string) string {
+	u, err := url.Parse(connStr)
+	if err != nil {
+		return ""
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.User(u.User.Username())
+	}
+	if u.RawQuery != "" {
+		q := u.Query()
+		removed := false
+		for k := range q {
+			if passwordParams[strings.ToLower(k)] {
+				q.Del(k)
+				removed = true
+			}
+		}
+		if removed {
+			u.RawQuery = q.Encode()
+		}
+	}
+	if s := u.String(); s != connStr {
+		return s
+	}
+	return connStr
+}
@@ -0,0 +1,164 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"cmdbox/model"
+)
+
+// ImportMode decides what ImportJSON does with an entry whose name is
+// already taken
+type ImportMode string
+
+const (
+	ImportSkip      ImportMode = "skip"      // keep the existing entry
+	ImportOverwrite ImportMode = "overwrite" // replace the existing entry
+	ImportRename    ImportMode = "rename"    // add it as "name 2", "name 3"...
+)
+
+// ParseImportMode checks s names an import mode
+func ParseImportMode(s string) (ImportMode, error) {
+	switch m := ImportMode(s); m {
+	case ImportSkip, ImportOverwrite, ImportRename:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown import mode %q, use skip, overwrite or rename", s)
+}
+
+// ImportResult counts what ImportJSON did, commands and queries together
+type ImportResult struct {
+	Added   int
+	Updated int // overwritten
+	Renamed int // added under a new name
+	Skipped int
+	Locked  int // of those skipped, locked commands overwrite left alone
+}
+
+// ImportJSON reads an export written by ExportJSON. Entries with a new
+// name are added; mode decides what happens to the rest. It all happens in
+// one transaction, so a bad entry leaves the database as it was.
+func (d *DB) ImportJSON(data []byte, mode ImportMode) (ImportResult, error) {
+	var result ImportResult
+	var export Export
+	if err := json.Unmarshal(data, &export); err != nil {
+		return result, fmt.Errorf("not a cmdbox export: %w", err)
+	}
+	if export.Version > ExportVersion {
+		return result, fmt.Errorf("export version %d is newer than this cmdbox reads (%d)", export.Version, ExportVersion)
+	}
+
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	for i, e := range export.Commands {
+		if strings.TrimSpace(e.Name) == "" || strings.TrimSpace(e.Cmd) == "" {
+			return result, fmt.Errorf("command %d has no name or command", i+1)
+		}
+		c := model.Command{
+			Name:        strings.TrimSpace(e.Name),
+			Cmd:         e.Cmd,
+			Description: e.Description,
+			Tags:        strings.Join(e.Tags, ","),
+			TimeoutSecs: e.TimeoutSecs,
+			Shell:       e.Shell,
+			WorkDir:     e.WorkDir,
+			Env:         e.Env,
+			Category:    e.Category,
+			Label:       e.Label,
+			Interactive: e.Interactive,
+		}
+		id, err := importEntry(tx, "commands", &c.Name, mode, &result,
+			func() (int64, error) { return addCommand(tx, c) },
+			func(id int64) error { c.ID = id; return updateCommand(tx, c) },
+		)
+		if err != nil {
+			return result, err
+		}
+		if id != 0 {
+			if _, err := tx.Exec(`UPDATE commands SET archived = ?, locked = ? WHERE id = ?`, e.Archived, e.Locked, id); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	for i, e := range export.Queries {
+		if strings.TrimSpace(e.Name) == "" || strings.TrimSpace(e.SQL) == "" {
+			return result, fmt.Errorf("query %d has no name or SQL", i+1)
+		}
+		q := model.Query{
+			Name:        strings.TrimSpace(e.Name),
+			SQL:         e.SQL,
+			Description: e.Description,
+			ConnString:  e.ConnString,
+		}
+		_, err := importEntry(tx, "queries", &q.Name, mode, &result,
+			func() (int64, error) { return addQuery(tx, q) },
+			func(id int64) error { q.ID = id; return updateQuery(tx, q) },
+		)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, tx.Commit()
+}
+
+// importEntry adds or updates one imported row of table, as mode says
+// when *name is taken, renaming it in place for ImportRename. It returns
+// the id written to, or 0 if the entry was skipped.
+func importEntry(tx *sql.Tx, table string, name *string, mode ImportMode, result *ImportResult,
+	add func() (int64, error), update func(id int64) error) (int64, error) {
+	existing, err := idByName(tx, table, *name)
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case existing == 0:
+		result.Added++
+	case mode == ImportOverwrite:
+		if err := update(existing); errors.Is(err, ErrLocked) {
+			result.Skipped++
+			result.Locked++
+			return 0, nil
+		} else if err != nil {
+			return 0, err
+		}
+		result.Updated++
+		return existing, nil
+	case mode == ImportRename:
+		base := *name
+		for n := 2; existing != 0; n++ {
+			*name = fmt.Sprintf("%s %d", base, n)
+			if existing, err = idByName(tx, table, *name); err != nil {
+				return 0, err
+			}
+		}
+		result.Renamed++
+	default:
+		result.Skipped++
+		return 0, nil
+	}
+	return add()
+}
+
+// idByName returns the id of the row of table named name, ignoring case and
+// surrounding spaces, or 0 if there's none
+func idByName(tx *sql.Tx, table, name string) (int64, error) {
+	var id int64
+	err := tx.QueryRow(
+		`SELECT id FROM `+table+` WHERE LOWER(TRIM(name)) = LOWER(?) LIMIT 1`,
+		strings.TrimSpace(name),
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return id, err
+}
@@ -0,0 +1,189 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// migration is one step of upgrading the schema
+type migration struct {
+	name  string
+	apply func(ctx context.Context, conn *sql.Conn) error
+}
+
+// migrations take the schema from one version to the next: applying
+// migrations[i] brings a database to version i+1. Only ever append to
+// this list; each database records how far through it it has got.
+//
+// Databases from before versioning start at 0 with some of these already
+// in place, so steps must tolerate that: tables are created IF NOT EXISTS
+// and addColumn skips columns that exist.
+var migrations = []migration{
+	{"create commands", execSQL(`
+		CREATE TABLE IF NOT EXISTS commands (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			cmd TEXT NOT NULL,
+			description TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			last_used_at DATETIME
+		);
+		CREATE INDEX IF NOT EXISTS idx_commands_name ON commands(name);
+		CREATE INDEX IF NOT EXISTS idx_commands_cmd ON commands(cmd);
+	`)},
+	{"add commands.last_params", addColumn("commands", "last_params", `TEXT DEFAULT ''`)},
+	{"add commands.timeout_secs", addColumn("commands", "timeout_secs", `INTEGER DEFAULT 0`)},
+	{"add commands.tags", addColumn("commands", "tags", `TEXT DEFAULT ''`)},
+	{"add commands.shell", addColumn("commands", "shell", `TEXT DEFAULT ''`)},
+	{"add commands.use_count", addColumn("commands", "use_count", `INTEGER DEFAULT 0`)},
+	{"add commands.work_dir", addColumn("commands", "work_dir", `TEXT DEFAULT ''`)},
+	{"add commands.env", addColumn("commands", "env", `TEXT DEFAULT ''`)},
+	{"add commands.secret_params", addColumn("commands", "secret_params", `TEXT DEFAULT ''`)},
+	{"add commands.category", addColumn("commands", "category", `TEXT DEFAULT ''`)},
+	{"add commands.archived", addColumn("commands", "archived", `INTEGER DEFAULT 0`)},
+
+	{"create queries", execSQL(`
+		CREATE TABLE IF NOT EXISTS queries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			sql TEXT NOT NULL,
+			description TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			last_used_at DATETIME
+		);
+		CREATE INDEX IF NOT EXISTS idx_queries_name ON queries(name);
+	`)},
+	{"add queries.conn_string", addColumn("queries", "conn_string", `TEXT DEFAULT ''`)},
+
+	// Execution history
+	{"create history", execSQL(`
+		CREATE TABLE IF NOT EXISTS history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			command_id INTEGER,
+			final_cmd TEXT NOT NULL,
+			exit_code INTEGER,
+			ran_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_history_ran_at ON history(ran_at);
+	`)},
+
+	// Key-value settings, e.g. the salt for encrypted params or UI preferences
+	{"create settings", execSQL(`
+		CREATE TABLE IF NOT EXISTS settings (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL
+		);
+	`)},
+
+	// Recent distinct values of each command's params
+	{"create param_history", execSQL(`
+		CREATE TABLE IF NOT EXISTS param_history (
+			command_id INTEGER NOT NULL,
+			param TEXT NOT NULL,
+			value TEXT NOT NULL,
+			used_at DATETIME NOT NULL,
+			PRIMARY KEY (command_id, param, value)
+		);
+	`)},
+
+	{"add commands.label", addColumn("commands", "label", `TEXT DEFAULT ''`)},
+	{"add commands.sort_order", addColumn("commands", "sort_order", `INTEGER DEFAULT 0`)},
+	{"number commands.sort_order", execSQL(`UPDATE commands SET sort_order = id`)},
+	{"add commands.interactive", addColumn("commands", "interactive", `INTEGER DEFAULT 0`)},
+	{"add commands.locked", addColumn("commands", "locked", `INTEGER DEFAULT 0`)},
+	{"add history.redacted", addColumn("history", "redacted", `INTEGER DEFAULT 0`)},
+	// Earlier runs only show they were masked by the quoted ****
+	{"mark redacted history", execSQL(`UPDATE history SET redacted = 1 WHERE final_cmd LIKE '%''****''%'`)},
+}
+
+// execSQL is a migration that runs query
+func execSQL(query string) func(context.Context, *sql.Conn) error {
+	return func(ctx context.Context, conn *sql.Conn) error {
+		_, err := conn.ExecContext(ctx, query)
+		return err
+	}
+}
+
+// addColumn is a migration that adds column to table unless it's there
+func addColumn(table, column, def string) func(context.Context, *sql.Conn) error {
+	return func(ctx context.Context, conn *sql.Conn) error {
+		var n int
+		err := conn.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column,
+		).Scan(&n)
+		if err != nil || n > 0 {
+			return err
+		}
+		_, err = conn.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, def))
+		return err
+	}
+}
+
+// migrate brings the schema up to date, applying each pending migration
+// in its own transaction along with the new version number, so a step
+// that fails is rolled back and tried again next time
+func (d *DB) migrate() error {
+	ctx := context.Background()
+	conn, err := d.conn.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Wait for another cmdbox migrating the same file rather than fail
+	if _, err := conn.ExecContext(ctx, `PRAGMA busy_timeout = 5000`); err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_version (
+			version INTEGER PRIMARY KEY,
+			applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	for {
+		done, err := applyNextMigration(ctx, conn)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// applyNextMigration applies the first migration the database doesn't
+// have yet, reporting done when there are none left
+func applyNextMigration(ctx context.Context, conn *sql.Conn) (done bool, err error) {
+	// IMMEDIATE takes the write lock before the version is read, so two
+	// processes starting together can't both apply the same step
+	if _, err := conn.ExecContext(ctx, `BEGIN IMMEDIATE`); err != nil {
+		return false, err
+	}
+	defer func() {
+		if err != nil {
+			conn.ExecContext(ctx, `ROLLBACK`)
+		}
+	}()
+
+	var version int
+	err = conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	if err != nil {
+		return false, err
+	}
+	if version >= len(migrations) {
+		_, err = conn.ExecContext(ctx, `COMMIT`)
+		return true, err
+	}
+
+	m := migrations[version]
+	if err := m.apply(ctx, conn); err != nil {
+		return false, fmt.Errorf("migration %d (%s): %w", version+1, m.name, err)
+	}
+	if _, err := conn.ExecContext(ctx, `INSERT INTO schema_version (version) VALUES (?)`, version+1); err != nil {
+		return false, err
+	}
+	_, err = conn.ExecContext(ctx, `COMMIT`)
+	return false, err
+}
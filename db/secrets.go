@@ -0,0 +1,146 @@
+package db
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// Sensitive param values are sealed with AES-GCM under a key derived from a
+// passphrase. The salt and a known value sealed with the key are kept in the
+// settings table so a wrong passphrase can be caught up front.
+
+const (
+	keyIterations = 600_000
+	secretCheck   = "cmdbox"
+)
+
+// ErrWrongPassphrase is returned by DeriveKey when the passphrase doesn't
+// match the one secrets were saved with
+var ErrWrongPassphrase = errors.New("wrong passphrase")
+
+// DeriveKey turns a passphrase into the key for sealing sensitive params.
+// The first call on a database sets the passphrase for later ones.
+func (d *DB) DeriveKey(passphrase string) ([]byte, error) {
+	salt, err := d.binarySetting("secret_salt")
+	if err != nil {
+		return nil, err
+	}
+	if salt == nil {
+		salt = make([]byte, 16)
+		rand.Read(salt)
+		if err := d.setBinarySetting("secret_salt", salt); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, keyIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	check, err := d.binarySetting("secret_check")
+	if err != nil {
+		return nil, err
+	}
+	if check == nil {
+		sealed, err := seal(key, []byte(secretCheck))
+		if err != nil {
+			return nil, err
+		}
+		return key, d.setBinarySetting("secret_check", sealed)
+	}
+	if plain, err := open(key, check); err != nil || string(plain) != secretCheck {
+		return nil, ErrWrongPassphrase
+	}
+	return key, nil
+}
+
+// SaveEncryptedParams stores sensitive param values sealed with key
+func (d *DB) SaveEncryptedParams(id int64, params map[string]string, key []byte) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	sealed, err := seal(key, data)
+	if err != nil {
+		return err
+	}
+	_, err = d.conn.Exec(`UPDATE commands SET secret_params = ? WHERE id = ?`,
+		base64.StdEncoding.EncodeToString(sealed), id)
+	return err
+}
+
+// LoadEncryptedParams returns the sensitive param values saved for a
+// command, or nil if none were saved. It fails if they can't be decrypted
+// with key.
+func (d *DB) LoadEncryptedParams(id int64, key []byte) (map[string]string, error) {
+	var encoded string
+	err := d.conn.QueryRow(`SELECT COALESCE(secret_params, '') FROM commands WHERE id = ?`, id).Scan(&encoded)
+	if err != nil || encoded == "" {
+		return nil, err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	data, err := open(key, sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	var params map[string]string
+	err = json.Unmarshal(data, &params)
+	return params, err
+}
+
+// binarySetting reads a base64-encoded setting, or nil if it isn't set
+func (d *DB) binarySetting(key string) ([]byte, error) {
+	encoded, err := d.Setting(key)
+	if err != nil || encoded == "" {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+func (d *DB) setBinarySetting(key string, value []byte) error {
+	return d.SetSetting(key, base64.StdEncoding.EncodeToString(value))
+}
+
+// seal encrypts data with AES-GCM, prefixing the random nonce
+func seal(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	rand.Read(nonce)
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+// open reverses seal
+func open(key, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("sealed data too short")
+	}
+	nonce, data := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, data, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
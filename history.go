@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// historyCommand is a distinct command from a shell history file
+type historyCommand struct {
+	cmd   string
+	count int // times it appears
+	last  int // position of its latest use, higher is more recent
+}
+
+// historyFile returns the default history file of shell, "bash" or "zsh"
+func historyFile(shell string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "."+shell+"_history"), nil
+}
+
+// parseHistory splits a bash or zsh history file into commands, oldest
+// first. zsh's extended format (": <time>:<duration>;cmd") and bash's
+// timestamp comments are understood, and lines ending in a backslash are
+// kept together with the next.
+func parseHistory(data []byte, shell string) []string {
+	if shell == "zsh" {
+		data = unmetafy(data)
+	}
+
+	var cmds []string
+	var cur strings.Builder
+	for _, line := range strings.Split(string(data), "\n") {
+		if cur.Len() == 0 {
+			if shell == "bash" && isTimestampComment(line) {
+				continue
+			}
+			if shell == "zsh" && strings.HasPrefix(line, ": ") {
+				if _, cmd, ok := strings.Cut(line, ";"); ok {
+					line = cmd
+				}
+			}
+		}
+		if strings.HasSuffix(line, `\`) {
+			cur.WriteString(line + "\n")
+			continue
+		}
+		cur.WriteString(line)
+		if cmd := strings.TrimSpace(cur.String()); cmd != "" {
+			cmds = append(cmds, cmd)
+		}
+		cur.Reset()
+	}
+	return cmds
+}
+
+// isTimestampComment reports whether line is a "#1699999999" line bash
+// writes when HISTTIMEFORMAT is set
+func isTimestampComment(line string) bool {
+	digits := strings.TrimPrefix(line, "#")
+	return digits != line && digits != "" && strings.Trim(digits, "0123456789") == ""
+}
+
+// unmetafy undoes zsh's escaping of special bytes in its history file:
+// 0x83 followed by a byte stands for that byte xor 32
+func unmetafy(data []byte) []byte {
+	const meta = 0x83
+	if bytes.IndexByte(data, meta) < 0 {
+		return data
+	}
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		if data[i] == meta && i+1 < len(data) {
+			i++
+			out = append(out, data[i]^32)
+			continue
+		}
+		out = append(out, data[i])
+	}
+	return out
+}
+
+// rankHistory de-duplicates cmds, ignoring whitespace differences and
+// those whose first word is in ignore, and orders them by how often they
+// were used, then how recently
+func rankHistory(cmds []string, ignore []string) []historyCommand {
+	index := make(map[string]int)
+	var ranked []historyCommand
+	for i, cmd := range cmds {
+		fields := strings.Fields(cmd)
+		if slices.Contains(ignore, fields[0]) {
+			continue
+		}
+		key := strings.Join(fields, " ")
+		if j, ok := index[key]; ok {
+			ranked[j].count++
+			ranked[j].last = i
+			continue
+		}
+		index[key] = len(ranked)
+		ranked = append(ranked, historyCommand{cmd: cmd, count: 1, last: i})
+	}
+
+	slices.SortStableFunc(ranked, func(a, b historyCommand) int {
+		if a.count != b.count {
+			return b.count - a.count
+		}
+		return b.last - a.last
+	})
+	return ranked
+}
+
+// historyName names an imported command after its first two words
+func historyName(cmd string) string {
+	fields := strings.Fields(cmd)
+	return strings.Join(fields[:min(len(fields), 2)], " ")
+}
@@ -1,24 +1,63 @@
 package main
 
 import (
+	"bufio"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"strings"
 
+	"cmdbox/config"
 	"cmdbox/db"
 	"cmdbox/ui"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/term"
 )
 
 func main() {
-	database, err := db.New()
+	dbPath := flag.String("db", "", "database file")
+	showVersion := flag.Bool("version", false, "print the version and exit")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Println("cmdbox " + versionString())
+		return
+	}
+
+	database, err := openDatabase(*dbPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error initializing database: %v\n", err)
+		if hint := databaseHint(err); hint != "" {
+			fmt.Fprintln(os.Stderr, hint)
+		}
 		os.Exit(1)
 	}
 	defer database.Close()
 
-	app, err := ui.NewApp(database)
+	if flag.NArg() > 0 {
+		code := runCLI(database, flag.Args())
+		database.Close()
+		os.Exit(code)
+	}
+
+	cfg, warnings, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring config.toml: %v\n", err)
+	}
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+
+	var secretKey []byte
+	if cfg.EncryptSecrets {
+		secretKey = unlockSecrets(database)
+	}
+
+	ui.Version = versionString()
+	app, err := ui.NewApp(database, cfg, secretKey)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error creating app: %v\n", err)
 		os.Exit(1)
@@ -30,3 +69,70 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// openDatabase opens the database at path, or the default one if path is
+// empty. If it's damaged, it offers to move it aside and start afresh.
+func openDatabase(path string) (*db.DB, error) {
+	if path == "" {
+		var err error
+		if path, err = db.DefaultPath(); err != nil {
+			return nil, err
+		}
+	}
+
+	database, err := db.NewWithPath(path)
+	if !errors.Is(err, db.ErrCorrupt) || !term.IsTerminal(os.Stdin.Fd()) {
+		return database, err
+	}
+
+	fmt.Fprintf(os.Stderr, "%s can't be read: %v\n", path, err)
+	fmt.Fprint(os.Stderr, "Move it aside and start with an empty database? [y/N] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+		return nil, err
+	}
+	backup, err := db.BackupCorrupt(path)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(os.Stderr, "Moved it to %s\n", backup)
+	return db.NewWithPath(path)
+}
+
+// databaseHint suggests what to do about an error opening the database
+func databaseHint(err error) string {
+	switch {
+	case errors.Is(err, db.ErrCorrupt):
+		return "Restore it from a backup, or move it away and cmdbox will create a new one."
+	case errors.Is(err, db.ErrReadOnly):
+		return "Make the file writable, or use --db or $CMDBOX_DB to keep it somewhere writable."
+	case errors.Is(err, db.ErrPermission):
+		return "Check you can read and write the file and its directory, or use --db to pick another."
+	case errors.Is(err, db.ErrDiskFull):
+		return "Free up some disk space and try again."
+	}
+	return ""
+}
+
+// unlockSecrets asks for the passphrase protecting saved sensitive params.
+// It returns nil, leaving secrets unremembered for this session, if the
+// prompt is skipped or the passphrase is wrong.
+func unlockSecrets(database *db.DB) []byte {
+	fmt.Fprint(os.Stderr, "Passphrase for saved secrets (enter to skip): ")
+	pass, err := term.ReadPassword(os.Stdin.Fd())
+	fmt.Fprintln(os.Stderr)
+	if err != nil || len(pass) == 0 {
+		return nil
+	}
+
+	key, err := database.DeriveKey(string(pass))
+	if errors.Is(err, db.ErrWrongPassphrase) {
+		fmt.Fprintln(os.Stderr, "Warning: wrong passphrase, secrets won't be remembered this session")
+		return nil
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: can't unlock secrets: %v\n", err)
+		return nil
+	}
+	return key
+}
@@ -1,6 +1,13 @@
 package model
 
-import "time"
+import (
+	"strings"
+	"time"
+)
+
+// NoTimeout is the TimeoutSecs of a command that never times out, even
+// when a default timeout is configured
+const NoTimeout = -1
 
 type Command struct {
 	ID          int64
@@ -10,4 +17,23 @@ type Command struct {
 	CreatedAt   time.Time
 	LastUsedAt  *time.Time
 	LastParams  string // JSON map of last-used param values
+	TimeoutSecs int    // 0 uses the default timeout; NoTimeout means none
+	Tags        string // comma-separated, lowercase
+	Shell       string // shell binary; empty uses the default
+	WorkDir     string // may use ~ and $VARS; empty runs in the current directory
+	Env         string // newline-separated KEY=VALUE pairs, may contain params
+	Category    string // "/"-separated path, e.g. infra/aws; empty is uncategorized
+	Label       string // palette color name like "red", or free text such as an emoji
+	UseCount    int
+	Archived    bool // hidden from the list until archived commands are shown
+	Interactive bool // runs attached to the terminal, or in a tmux window, instead of streaming output
+	Locked      bool // can't be edited or deleted until unlocked
+}
+
+// TagList returns the command's tags as a slice
+func (c Command) TagList() []string {
+	if c.Tags == "" {
+		return nil
+	}
+	return strings.Split(c.Tags, ",")
 }
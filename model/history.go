@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+type HistoryEntry struct {
+	ID          int64
+	CommandID   int64
+	CommandName string // empty if the command has since been deleted
+	FinalCmd    string // substituted command, sensitive values masked
+	Redacted    bool   // whether FinalCmd had sensitive values masked
+	ExitCode    int
+	RanAt       time.Time
+}
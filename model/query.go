@@ -9,4 +9,5 @@ type Query struct {
 	Description string
 	CreatedAt   time.Time
 	LastUsedAt  *time.Time
+	ConnString  string // postgres://, mysql:// or sqlite:// URL
 }
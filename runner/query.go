@@ -0,0 +1,434 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Row is a single query result row. Columns is shared by every row of a
+// result; Values holds the driver values in column order, nil for NULL.
+type Row struct {
+	Columns []string
+	Values  []any
+}
+
+// RunQuery runs sql against the database named by connStr and returns all rows.
+// The driver is picked from the scheme: postgres://, mysql:// or sqlite://.
+// Params in query are bound to their values by the driver, never pasted in.
+// Cancelling ctx stops the query, or the reading of its rows, and returns
+// ctx's error.
+func RunQuery(ctx context.Context, connStr, query string, values map[string]string) ([]Row, error) {
+	driver, dsn, err := parseConnString(connStr)
+	if err != nil {
+		return nil, err
+	}
+	query, args, err := bindQueryParams(driver, query, values)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Row
+	for rows.Next() {
+		values := make([]any, len(columns))
+		ptrs := make([]any, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		// Drivers hand back text columns as []byte
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		result = append(result, Row{Columns: columns, Values: values})
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return result, rows.Err()
+}
+
+// queryParam is a param placeholder found at query[start:end]
+type queryParam struct {
+	start, end int
+	info       ParamInfo
+}
+
+// findQueryParams returns the :name and {{name}} placeholders in query.
+// Strings, quoted identifiers, comments and casts like ::int are skipped,
+// so placeholders stand for whole values and are never quoted.
+func findQueryParams(query string) []queryParam {
+	var found []queryParam
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				return found
+			}
+			i += end + 1
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				return found
+			}
+			i += end + 4
+		case c == '\'' || c == '"' || c == '`':
+			i = skipQuoted(query, i)
+		case c == ':' && strings.HasPrefix(query[i:], "::"):
+			i += 2
+		case c == ':' && (i == 0 || !isWordByte(query[i-1])) && i+1 < len(query) && (isLetter(query[i+1]) || query[i+1] == '_'):
+			end := i + 1
+			for end < len(query) && isWordByte(query[end]) {
+				end++
+			}
+			found = append(found, queryParam{i, end, ParamInfo{Name: query[i+1 : end]}})
+			i = end
+		case c == '{' && strings.HasPrefix(query[i:], "{{"):
+			m := paramRegex.FindStringSubmatch(query[i:])
+			if m == nil || !strings.HasPrefix(query[i:], m[0]) {
+				i++
+				continue
+			}
+			found = append(found, queryParam{i, i + len(m[0]), paramFromMatch(m)})
+			i += len(m[0])
+		default:
+			i++
+		}
+	}
+	return found
+}
+
+// ExtractQueryParams returns the params of a query, written :name or
+// {{name}}. The {{name}} form takes the same markers and specs as
+// commands, like {{!password}} or {{limit:int:10}}.
+func ExtractQueryParams(query string) []ParamInfo {
+	index := make(map[string]int)
+	var params []ParamInfo
+	for _, qp := range findQueryParams(query) {
+		params = addParam(params, index, qp.info)
+	}
+	return params
+}
+
+// bindQueryParams rewrites the params in query to driver's placeholders,
+// $1 for postgres and ? for mysql and sqlite, and returns the arguments
+// to bind to them. int and number params are bound as numbers.
+func bindQueryParams(driver, query string, values map[string]string) (string, []any, error) {
+	found := findQueryParams(query)
+	if len(found) == 0 {
+		return query, nil, nil
+	}
+
+	params := ExtractQueryParams(query)
+	args := make(map[string]any, len(params))
+	for _, p := range params {
+		value, ok := values[p.Name]
+		if !ok {
+			return "", nil, fmt.Errorf("no value for param %s", p.Name)
+		}
+		if err := ValidateParam(p, value); err != nil {
+			return "", nil, err
+		}
+		switch p.Type {
+		case "int":
+			args[p.Name], _ = strconv.ParseInt(value, 10, 64)
+		case "number":
+			args[p.Name], _ = strconv.ParseFloat(value, 64)
+		default:
+			args[p.Name] = value
+		}
+	}
+
+	var b strings.Builder
+	var bound []any
+	positions := make(map[string]int) // postgres reuses $N for a repeated param
+	last := 0
+	for _, qp := range found {
+		b.WriteString(query[last:qp.start])
+		last = qp.end
+		if driver != "postgres" {
+			b.WriteString("?")
+			bound = append(bound, args[qp.info.Name])
+			continue
+		}
+		n, ok := positions[qp.info.Name]
+		if !ok {
+			bound = append(bound, args[qp.info.Name])
+			n = len(bound)
+			positions[qp.info.Name] = n
+		}
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+	b.WriteString(query[last:])
+	return b.String(), bound, nil
+}
+
+// FormatValue renders a result value for display
+func FormatValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// parseConnString maps a connection URL to a database/sql driver name and DSN
+func parseConnString(connStr string) (driver, dsn string, err error) {
+	switch {
+	case connStr == "":
+		return "", "", fmt.Errorf("no connection string set")
+
+	case strings.HasPrefix(connStr, "postgres://"), strings.HasPrefix(connStr, "postgresql://"):
+		return "postgres", connStr, nil
+
+	case strings.HasPrefix(connStr, "mysql://"):
+		u, err := url.Parse(connStr)
+		if err != nil {
+			return "", "", err
+		}
+		cfg := mysql.NewConfig()
+		cfg.User = u.User.Username()
+		cfg.Passwd, _ = u.User.Password()
+		cfg.Net = "tcp"
+		cfg.Addr = u.Host
+		cfg.DBName = strings.TrimPrefix(u.Path, "/")
+		cfg.ParseTime = true
+		for k, v := range u.Query() {
+			if cfg.Params == nil {
+				cfg.Params = make(map[string]string)
+			}
+			cfg.Params[k] = v[0]
+		}
+		return "mysql", cfg.FormatDSN(), nil
+
+	case strings.HasPrefix(connStr, "sqlite://"):
+		path := strings.TrimPrefix(connStr, "sqlite://")
+		if strings.HasPrefix(path, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", "", err
+			}
+			path = filepath.Join(home, path[2:])
+		}
+		return "sqlite3", path, nil
+	}
+
+	return "", "", fmt.Errorf("unsupported connection string (use postgres://, mysql:// or sqlite://)")
+}
+
+// QueryResultToCSV renders rows as RFC 4180 CSV with a header row of
+// column names. NULLs become empty fields.
+func QueryResultToCSV(rows []Row) []byte {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.UseCRLF = true
+	w.Write(rows[0].Columns)
+	for _, r := range rows {
+		record := make([]string, len(r.Values))
+		for i, v := range r.Values {
+			if v != nil {
+				record[i] = FormatValue(v)
+			}
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return b.Bytes()
+}
+
+// readOnlyKeywords start statements that only read
+var readOnlyKeywords = map[string]bool{
+	"SELECT": true, "SHOW": true, "DESCRIBE": true, "DESC": true, "EXPLAIN": true, "VALUES": true,
+}
+
+// IsReadOnlyQuery reports whether every statement in query starts with a
+// keyword that only reads, like SELECT. It checks leading keywords rather
+// than parsing, so anything unusual, like a leading WITH, counts as a write.
+func IsReadOnlyQuery(query string) bool {
+	for _, kind := range StatementKinds(query) {
+		if !readOnlyKeywords[kind] {
+			return false
+		}
+	}
+	return true
+}
+
+// limitBlockers are words that mean a query already limits its rows, or
+// that a LIMIT can't simply be appended after
+var limitBlockers = map[string]bool{
+	"LIMIT": true, "OFFSET": true, "FETCH": true, "TOP": true, "FOR": true, "INTO": true,
+}
+
+// ApplyPreviewLimit appends "LIMIT limit" to a single SELECT statement
+// that doesn't already limit its rows, so previewing a big table doesn't
+// load all of it. Anything else, including a limit in a subquery, is
+// returned unchanged.
+func ApplyPreviewLimit(query string, limit int) string {
+	if limit <= 0 {
+		return query
+	}
+	kinds := StatementKinds(query)
+	if len(kinds) != 1 || kinds[0] != "SELECT" {
+		return query
+	}
+	words, end := sqlWords(query)
+	for _, w := range words {
+		if limitBlockers[w] {
+			return query
+		}
+	}
+	// On its own line, so a trailing -- comment can't swallow it
+	return fmt.Sprintf("%s\nLIMIT %d%s", query[:end], limit, query[end:])
+}
+
+// sqlWords returns the uppercased words of query outside strings and
+// comments, and the index just past the last of it that isn't space, a
+// comment or a semicolon
+func sqlWords(query string) (words []string, end int) {
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			next := strings.IndexByte(query[i:], '\n')
+			if next < 0 {
+				return words, end
+			}
+			i += next + 1
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			next := strings.Index(query[i+2:], "*/")
+			if next < 0 {
+				return words, end
+			}
+			i += next + 4
+		case c == ';' || c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '\'' || c == '"' || c == '`':
+			i = skipQuoted(query, i)
+			end = i
+		case isLetter(c) || c == '_':
+			start := i
+			for i < len(query) && isWordByte(query[i]) {
+				i++
+			}
+			words = append(words, strings.ToUpper(query[start:i]))
+			end = i
+		default:
+			i++
+			end = i
+		}
+	}
+	return words, end
+}
+
+// StatementKinds returns the uppercased leading keyword of each statement
+// in query, skipping comments and semicolons inside strings. A statement
+// that doesn't start with a word, like "(SELECT 1)", gives "".
+func StatementKinds(query string) []string {
+	var kinds []string
+	atStart := true
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				return kinds
+			}
+			i += end + 1
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				return kinds
+			}
+			i += end + 4
+		case c == ';':
+			atStart = true
+			i++
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case !atStart:
+			if c == '\'' || c == '"' || c == '`' {
+				i = skipQuoted(query, i)
+			} else {
+				i++
+			}
+		default:
+			start := i
+			for i < len(query) && (isLetter(query[i]) || query[i] == '_') {
+				i++
+			}
+			kinds = append(kinds, strings.ToUpper(query[start:i]))
+			atStart = false
+		}
+	}
+	return kinds
+}
+
+// skipQuoted returns the index just past the quoted string starting at i,
+// where a doubled quote is an escaped one
+func skipQuoted(s string, i int) int {
+	quote := s[i]
+	for i++; i < len(s); i++ {
+		if s[i] == quote {
+			if i+1 < len(s) && s[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return i
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isWordByte(c byte) bool {
+	return isLetter(c) || c >= '0' && c <= '9' || c == '_'
+}
@@ -0,0 +1,24 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunQueryCancel(t *testing.T) {
+	conn := "sqlite://" + t.TempDir() + "/q.db"
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// Counts forever unless interrupted
+	start := time.Now()
+	_, err := RunQuery(ctx, conn, `WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c) SELECT count(*) FROM c`, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want the context's error", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("query took %v to stop", d)
+	}
+}
@@ -0,0 +1,98 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Matches {{@name}}, which stands for the output of the saved command
+// called name. Unlike params, names may contain spaces.
+var refRegex = regexp.MustCompile(`\{\{@([^}]+)\}\}`)
+
+// HasRefs reports whether cmd references other commands with {{@name}},
+// ignoring comment lines
+func HasRefs(cmd string) bool {
+	return refRegex.MatchString(StripComments(cmd))
+}
+
+// maxRefDepth is how deeply commands may reference each other
+const maxRefDepth = 5
+
+// resolveRefs replaces each {{@name}} in cmd with the trimmed stdout of the
+// command opts.Lookup finds for name, escaped like a param value. Referenced
+// commands run with their param defaults and may reference others in turn.
+// chain holds the names being resolved further up, to catch loops.
+func resolveRefs(ctx context.Context, cmd string, opts Options, chain []string) (string, error) {
+	outputs := make(map[string]string)
+	for _, m := range refRegex.FindAllStringSubmatch(cmd, -1) {
+		name := strings.TrimSpace(m[1])
+		if _, ok := outputs[name]; ok {
+			continue
+		}
+		if slices.Contains(chain, name) {
+			return "", fmt.Errorf("command references loop: %s -> %s", strings.Join(chain, " -> "), name)
+		}
+		if len(chain) >= maxRefDepth {
+			return "", fmt.Errorf("{{@%s}} is nested more than %d references deep", name, maxRefDepth)
+		}
+
+		out, err := runRef(ctx, name, opts, append(chain, name))
+		if err != nil {
+			return "", err
+		}
+		outputs[name] = out
+	}
+
+	return replaceEscaped(cmd, refRegex, func(m []int) (string, bool, bool) {
+		return outputs[strings.TrimSpace(cmd[m[2]:m[3]])], true, false
+	}), nil
+}
+
+// runRef runs the saved command called name and returns its trimmed
+// stdout. A non-zero exit is an error that includes its stderr. parent
+// supplies the lookup and the defaults for unset options.
+func runRef(ctx context.Context, name string, parent Options, chain []string) (string, error) {
+	ref, err := parent.Lookup(name)
+	if err != nil {
+		return "", fmt.Errorf("{{@%s}}: %w", name, err)
+	}
+
+	defaults := make(map[string]string)
+	for _, p := range CommandParams(*ref) {
+		if p.Default != "" {
+			defaults[p.Name] = p.Default
+		}
+	}
+	cmd := SubstituteParams(StripComments(ref.Cmd), defaults)
+	if left := FindUnsubstituted(cmd); len(left) > 0 {
+		return "", fmt.Errorf("{{@%s}} needs params without defaults: %s", name, strings.Join(left, ", "))
+	}
+	if cmd, err = resolveRefs(ctx, cmd, parent, chain); err != nil {
+		return "", err
+	}
+
+	opts := CommandOptions(*ref, defaults, parent.Defaults)
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	c, _, err := newCmd(ctx, cmd, opts)
+	if err != nil {
+		return "", fmt.Errorf("{{@%s}}: %w", name, err)
+	}
+	setProcessGroup(c)
+	var stdout, stderr bytes.Buffer
+	c.Stdout, c.Stderr = &stdout, &stderr
+	if err := c.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("{{@%s}} failed: %v: %s", name, err, msg)
+		}
+		return "", fmt.Errorf("{{@%s}} failed: %v", name, err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -2,99 +2,684 @@ package runner
 
 import (
 	"bufio"
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"cmdbox/model"
 )
 
-var paramRegex = regexp.MustCompile(`\{\{(!)?(\w+)\}\}`)
+// Matches {{name}}, {{!name}} (sensitive), {{=name}} (raw) and any of them
+// with a spec after a colon: {{name:default}}, {{name:int}},
+// {{name:enum(a,b):a}}. The markers combine as {{!=name}}. An @env:VAR
+// after the name fills the param from $VAR: {{!token@env:GITHUB_TOKEN}}.
+var paramRegex = regexp.MustCompile(`\{\{(!)?(=)?(\w+)(?:@env:(\w+))?(?::([^}]*))?\}\}`)
+
+// placeholderRegex matches anything opened with {{, closed or not, for
+// FindMalformed to check
+var placeholderRegex = regexp.MustCompile(`\{\{[^{}\n]*(\}\}?)?`)
+
+// paramLike matches the name part of text meant as a param
+var paramLike = regexp.MustCompile(`^\s*[!=@]*\s*\w+\s*$`)
+
+// shellSafe matches values the shell passes through unchanged
+var shellSafe = regexp.MustCompile(`^[\w@%+=:,./-]+$`)
+
+var doubleQuoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
 
 // ParamInfo holds param name and whether it's sensitive
 type ParamInfo struct {
 	Name      string
 	Sensitive bool
+	Default   string // from {{name:default}}, used when nothing was remembered
+	Type      string // "", "int", "number" or "enum"
+	Choices   []string
+	EnvVar    string // from {{name@env:VAR}}, read when no value is given
 }
 
 // ExtractParams returns all {{param}} and {{!param}} from a command string
 func ExtractParams(cmd string) []ParamInfo {
-	matches := paramRegex.FindAllStringSubmatch(cmd, -1)
-	seen := make(map[string]bool)
+	index := make(map[string]int)
 	var params []ParamInfo
-	for _, m := range matches {
-		sensitive := m[1] == "!"
-		name := m[2]
-		if !seen[name] {
-			seen[name] = true
-			params = append(params, ParamInfo{Name: name, Sensitive: sensitive})
-		}
+	for _, m := range paramRegex.FindAllStringSubmatch(cmd, -1) {
+		params = addParam(params, index, paramFromMatch(m))
 	}
 	return params
 }
 
-// SubstituteParams replaces {{param}} and {{!param}} with provided values
+// paramFromMatch builds the ParamInfo for one paramRegex match
+func paramFromMatch(m []string) ParamInfo {
+	typ, choices, def := parseParamSpec(m[5])
+	return ParamInfo{
+		Name:      m[3],
+		Sensitive: m[1] == "!",
+		Default:   def,
+		Type:      typ,
+		Choices:   choices,
+		EnvVar:    m[4],
+	}
+}
+
+// addParam appends p to params unless a param of that name is already
+// there, indexed by name in index
+func addParam(params []ParamInfo, index map[string]int, p ParamInfo) []ParamInfo {
+	i, ok := index[p.Name]
+	if !ok {
+		index[p.Name] = len(params)
+		return append(params, p)
+	}
+	// A later occurrence may be the one carrying the spec
+	if params[i].Default == "" {
+		params[i].Default = p.Default
+	}
+	if params[i].EnvVar == "" {
+		params[i].EnvVar = p.EnvVar
+	}
+	if params[i].Type == "" {
+		params[i].Type, params[i].Choices = p.Type, p.Choices
+	}
+	return params
+}
+
+// CommandParams returns the params used by c, including any in its
+// environment but not any in comments
+func CommandParams(c model.Command) []ParamInfo {
+	return ExtractParams(StripComments(c.Cmd) + "\n" + c.Env)
+}
+
+// heredocRegex matches the start of a heredoc, capturing its delimiter,
+// e.g. <<EOF, <<-'EOF' or << "END" but not a <<< here-string
+var heredocRegex = regexp.MustCompile(`(?:^|[^<])<<-?\s*['"]?(\w+)`)
+
+// StripComments removes full-line # comments from cmd so a command can
+// carry notes that are neither run nor asked about. Only lines starting
+// with # go: echo "#hi" still prints the hash, and # lines inside a
+// multi-line string, a heredoc or after a line ending in \ are kept.
+func StripComments(cmd string) string {
+	var kept []string
+	var quote byte
+	var heredocs []string // delimiters of the heredocs still open, in order
+	continued := false
+	for _, line := range strings.Split(cmd, "\n") {
+		if len(heredocs) > 0 {
+			if strings.TrimLeft(line, "\t") == heredocs[0] {
+				heredocs = heredocs[1:]
+			}
+			kept = append(kept, line)
+			continue
+		}
+		if quote == 0 && !continued && strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		if quote == 0 {
+			for _, m := range heredocRegex.FindAllStringSubmatchIndex(line, -1) {
+				start := m[0]
+				if line[start] != '<' {
+					start++ // the match starts with the byte before <<
+				}
+				if scanQuotes(line[:start], 0) == 0 && !inArithmetic(line[:start]) {
+					heredocs = append(heredocs, line[m[2]:m[3]])
+				}
+			}
+		}
+		quote = scanQuotes(line, quote)
+		continued = quote == 0 && strings.HasSuffix(line, `\`)
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, "\n")
+}
+
+// FindUnsubstituted returns the names of params still present in cmd after
+// substitution. Other {{...}} text, like Go templates, is ignored.
+func FindUnsubstituted(cmd string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, m := range paramRegex.FindAllStringSubmatch(cmd, -1) {
+		if !seen[m[3]] {
+			seen[m[3]] = true
+			names = append(names, m[3])
+		}
+	}
+	return names
+}
+
+// FindMalformed returns placeholders in cmd that look like params but
+// won't be substituted, like "{{ name }}" or an unclosed "{{name}".
+// Other {{...}} text, like Go templates, is left alone.
+func FindMalformed(cmd string) []string {
+	var bad []string
+	for _, m := range placeholderRegex.FindAllStringSubmatch(cmd, -1) {
+		if m[1] == "}}" && (paramRegex.MatchString(m[0]) || refRegex.MatchString(m[0])) {
+			continue
+		}
+		inner := strings.TrimRight(strings.TrimPrefix(m[0], "{{"), "}")
+		head, _, _ := strings.Cut(inner, ":")
+		if paramLike.MatchString(head) {
+			bad = append(bad, m[0])
+		}
+	}
+	return bad
+}
+
+// parseParamSpec splits the text after a param name into a type and a
+// default. "int", "number" and "enum(a,b)" are types and may carry their
+// own default ("int:8080"); anything else is taken as the default.
+func parseParamSpec(spec string) (typ string, choices []string, def string) {
+	head, def, _ := strings.Cut(spec, ":")
+	switch {
+	case head == "int", head == "number":
+		return head, nil, def
+	case strings.HasPrefix(head, "enum(") && strings.HasSuffix(head, ")"):
+		for _, c := range strings.Split(head[5:len(head)-1], ",") {
+			if c = strings.TrimSpace(c); c != "" {
+				choices = append(choices, c)
+			}
+		}
+		return "enum", choices, def
+	}
+	return "", nil, spec
+}
+
+// ValidateParam checks a value against the param's type annotation
+func ValidateParam(p ParamInfo, value string) error {
+	switch p.Type {
+	case "int":
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("%s must be an integer", p.Name)
+		}
+	case "number":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("%s must be a number", p.Name)
+		}
+	case "enum":
+		for _, c := range p.Choices {
+			if value == c {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s must be one of %s", p.Name, strings.Join(p.Choices, ", "))
+	}
+	return nil
+}
+
+// SubstituteParams replaces {{param}} and {{!param}} with provided values,
+// escaped so the shell sees each value as one literal word. A placeholder
+// inside single or double quotes is escaped for those quotes; one outside
+// quotes is single-quoted if the value has anything the shell would
+// interpret. {{=param}} inserts the value raw, e.g. for a list of flags.
+// Placeholders without a value are left as-is.
 func SubstituteParams(cmd string, values map[string]string) string {
-	result := cmd
-	for name, value := range values {
-		result = strings.ReplaceAll(result, "{{"+name+"}}", value)
-		result = strings.ReplaceAll(result, "{{!"+name+"}}", value)
+	return replaceEscaped(cmd, paramRegex, func(m []int) (string, bool, bool) {
+		value, ok := values[cmd[m[6]:m[7]]]
+		return value, ok, m[4] >= 0 // {{=param}} is raw
+	})
+}
+
+// replaceEscaped replaces each match of re in cmd with the value returned
+// by replace for its submatch indexes, escaped for the quotes around it
+// unless raw. Matches replace has no value for are left as-is.
+func replaceEscaped(cmd string, re *regexp.Regexp, replace func(m []int) (value string, ok, raw bool)) string {
+	var b strings.Builder
+	var quote byte // the quote the shell is inside at this point, if any
+	last := 0
+	for _, m := range re.FindAllStringSubmatchIndex(cmd, -1) {
+		quote = scanQuotes(cmd[last:m[0]], quote)
+		b.WriteString(cmd[last:m[0]])
+		last = m[1]
+
+		value, ok, raw := replace(m)
+		switch {
+		case !ok:
+			value = cmd[m[0]:m[1]]
+		case !raw:
+			value = quoteFor(quote, value)
+		}
+		b.WriteString(value)
+	}
+	b.WriteString(cmd[last:])
+	return b.String()
+}
+
+// SubstituteParamsRaw replaces params with provided values unescaped, for
+// text that isn't run by a shell, like environment variables
+func SubstituteParamsRaw(text string, values map[string]string) string {
+	return paramRegex.ReplaceAllStringFunc(text, func(m string) string {
+		name := paramRegex.FindStringSubmatch(m)[3]
+		if value, ok := values[name]; ok {
+			return value
+		}
+		return m
+	})
+}
+
+// scanQuotes returns the quote the shell is inside after reading s, given
+// the one it was inside before s, or 0 for none
+func scanQuotes(s string, quote byte) byte {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			}
+		case c == '\\':
+			i++ // backslash escapes the next byte, except in single quotes
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		}
+	}
+	return quote
+}
+
+// inArithmetic reports whether the end of s is inside a $((...)) or
+// ((...)) arithmetic expression, where << is a shift, not a heredoc
+func inArithmetic(s string) bool {
+	depth := 0
+	for i := 0; i+1 < len(s); i++ {
+		switch s[i : i+2] {
+		case "((":
+			depth++
+			i++
+		case "))":
+			depth = max(depth-1, 0)
+			i++
+		}
+	}
+	return depth > 0
+}
+
+// HasSubstitution reports whether cmd runs $(...) or `...` command
+// substitutions, ignoring comment lines, single-quoted text and $((...))
+// arithmetic
+func HasSubstitution(cmd string) bool {
+	cmd = StripComments(cmd)
+	var quote byte
+	for i := 0; i < len(cmd); i++ {
+		c := cmd[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			}
+		case c == '\\':
+			i++
+		case c == '`':
+			return true
+		case c == '$' && strings.HasPrefix(cmd[i+1:], "(") && !strings.HasPrefix(cmd[i+1:], "(("):
+			return true
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		}
+	}
+	return false
+}
+
+// quoteFor escapes value for use inside quote, or outside quotes if 0
+func quoteFor(quote byte, value string) string {
+	switch quote {
+	case '\'':
+		return strings.ReplaceAll(value, "'", `'\''`)
+	case '"':
+		return doubleQuoteEscaper.Replace(value)
+	}
+	return ShellQuote(value)
+}
+
+// ShellQuote single-quotes s unless the shell would pass it through
+// unchanged anyway
+func ShellQuote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// FromEnv returns the value of p's environment variable, or "" if it has
+// none or it's unset
+func (p ParamInfo) FromEnv() string {
+	if p.EnvVar == "" {
+		return ""
+	}
+	return os.Getenv(p.EnvVar)
+}
+
+// MaskSensitive returns a copy of values with sensitive params replaced by ****
+func MaskSensitive(params []ParamInfo, values map[string]string) map[string]string {
+	masked := make(map[string]string, len(values))
+	for k, v := range values {
+		masked[k] = v
+	}
+	for _, p := range params {
+		if p.Sensitive {
+			masked[p.Name] = "****"
+		}
 	}
-	return result
+	return masked
+}
+
+// OutputLine is one line of command output, sent to the channel in the
+// Lines of an OutputMsg
+type OutputLine struct {
+	Text  string
+	IsErr bool // from stderr
 }
 
-// OutputMsg is sent through the channel for each line of output
+// OutputMsg carries the lines produced since the previous message, or the
+// result once the command is Done
 type OutputMsg struct {
-	Line   string
-	IsErr  bool
-	Done   bool
-	ErrMsg string
+	Lines       []OutputLine
+	Done        bool
+	ErrMsg      string
+	Interrupted bool // set on the final message when ctx was cancelled
+
+	// Set on the final message only
+	ExitCode int // -1 if the process didn't exit normally
+	Duration time.Duration
 }
 
-// Run executes a command and streams output through a channel
-func Run(cmd string, output chan<- OutputMsg) {
+// Options control how a command is executed
+type Options struct {
+	Timeout time.Duration // 0 means no timeout
+	Shell   string        // empty falls back to $SHELL, then sh
+	Dir     string        // working directory; ~ and $VARS are expanded
+	Env     []string      // extra KEY=VALUE lines added to the environment
+
+	// Lookup finds the saved commands that {{@name}} refers to. When nil,
+	// references are left as-is.
+	Lookup func(name string) (*model.Command, error)
+
+	// Defaults are passed on to the commands {{@name}} runs
+	Defaults RunConfig
+}
+
+// RunConfig holds the timeout and shell used by commands that don't set
+// their own
+type RunConfig struct {
+	Timeout time.Duration // 0 means no timeout
+	Shell   string        // empty falls back to $SHELL, then sh
+}
+
+// CommandOptions returns the options a saved command runs with, with
+// params in its environment filled in from values and anything it leaves
+// unset taken from defaults
+func CommandOptions(c model.Command, values map[string]string, defaults RunConfig) Options {
+	opts := Options{
+		Timeout:  defaults.Timeout,
+		Shell:    c.Shell,
+		Dir:      c.WorkDir,
+		Defaults: defaults,
+	}
+	switch {
+	case c.TimeoutSecs > 0:
+		opts.Timeout = time.Duration(c.TimeoutSecs) * time.Second
+	case c.TimeoutSecs == model.NoTimeout:
+		opts.Timeout = 0
+	}
+	if opts.Shell == "" {
+		opts.Shell = defaults.Shell
+	}
+	if c.Env != "" {
+		opts.Env = strings.Split(SubstituteParamsRaw(c.Env, values), "\n")
+	}
+	return opts
+}
+
+// shell returns the shell binary to run commands with
+func (o Options) shell() string {
+	if o.Shell != "" {
+		return o.Shell
+	}
+	if sh := os.Getenv("SHELL"); sh != "" {
+		return sh
+	}
+	return "sh"
+}
+
+// ExpandPath expands $VARS and a leading ~ in a path
+func ExpandPath(path string) (string, error) {
+	path = os.ExpandEnv(path)
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, path[1:])
+	}
+	return path, nil
+}
+
+// Run executes a command and streams output through a channel.
+// Cancelling ctx kills the command along with any children it spawned.
+func Run(ctx context.Context, cmd string, opts Options, output chan<- OutputMsg) {
 	defer close(output)
 
-	c := exec.Command("sh", "-c", cmd)
+	parent := ctx
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	if opts.Lookup != nil {
+		resolved, err := resolveRefs(ctx, cmd, opts, nil)
+		if err != nil {
+			output <- OutputMsg{Done: true, ErrMsg: err.Error(), ExitCode: -1}
+			return
+		}
+		cmd = resolved
+	}
+
+	c, skipped, err := newCmd(ctx, cmd, opts)
+	if err != nil {
+		output <- OutputMsg{Done: true, ErrMsg: err.Error(), ExitCode: -1}
+		return
+	}
+	setProcessGroup(c)
+	for _, line := range skipped {
+		output <- OutputMsg{Lines: []OutputLine{{Text: "warning: ignoring env line without KEY=VALUE: " + line, IsErr: true}}}
+	}
 
 	stdout, err := c.StdoutPipe()
 	if err != nil {
-		output <- OutputMsg{Done: true, ErrMsg: err.Error()}
+		output <- OutputMsg{Done: true, ErrMsg: err.Error(), ExitCode: -1}
 		return
 	}
 
 	stderr, err := c.StderrPipe()
 	if err != nil {
-		output <- OutputMsg{Done: true, ErrMsg: err.Error()}
+		output <- OutputMsg{Done: true, ErrMsg: err.Error(), ExitCode: -1}
 		return
 	}
 
+	start := time.Now()
 	if err := c.Start(); err != nil {
-		output <- OutputMsg{Done: true, ErrMsg: err.Error()}
+		output <- OutputMsg{Done: true, ErrMsg: err.Error(), ExitCode: -1}
 		return
 	}
 
-	// Stream stdout and stderr concurrently
-	done := make(chan struct{}, 2)
+	// Stream stdout and stderr concurrently into one batched feed
+	lines := make(chan OutputLine, 256)
+	var wg sync.WaitGroup
+	wg.Add(2)
 
 	streamReader := func(r io.Reader, isErr bool) {
+		defer wg.Done()
 		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxLineBytes)
+		scanner.Split(scanLongLines)
 		for scanner.Scan() {
-			output <- OutputMsg{Line: scanner.Text(), IsErr: isErr}
+			// Binary or latin-1 output would garble the screen
+			text := strings.ToValidUTF8(scanner.Text(), "\uFFFD")
+			lines <- OutputLine{Text: text, IsErr: isErr}
 		}
-		done <- struct{}{}
 	}
 
 	go streamReader(stdout, false)
 	go streamReader(stderr, true)
+	go func() {
+		wg.Wait()
+		close(lines)
+	}()
 
-	// Wait for both streams
-	<-done
-	<-done
+	batchOutput(lines, output)
 
 	err = c.Wait()
+	final := OutputMsg{
+		Done:     true,
+		ExitCode: c.ProcessState.ExitCode(),
+		Duration: time.Since(start),
+	}
+
+	var exitErr *exec.ExitError
+	if parent.Err() != nil {
+		final.Interrupted = true
+	} else if ctx.Err() != nil {
+		final.ErrMsg = fmt.Sprintf("timed out after %ds", int(opts.Timeout.Seconds()))
+	} else if err != nil && (!errors.As(err, &exitErr) || exitErr.ExitCode() < 0) {
+		// Non-zero exits are reported through ExitCode; this covers
+		// signals and I/O failures
+		final.ErrMsg = err.Error()
+	}
+	output <- final
+}
+
+// maxLineBytes is the longest line read from a command; longer ones are
+// split into pieces of this size
+const maxLineBytes = 1024 * 1024
+
+// scanLongLines splits output into lines like bufio.ScanLines, but hands
+// back a full buffer as a line of its own rather than failing on a line
+// longer than maxLineBytes, so the rest of the output still gets read
+func scanLongLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	advance, token, err = bufio.ScanLines(data, atEOF)
+	if advance == 0 && err == nil && len(data) >= maxLineBytes {
+		return maxLineBytes, data[:maxLineBytes], nil
+	}
+	return advance, token, err
+}
+
+// newCmd builds the process for cmd with opts' shell, directory and
+// environment. skipped lists env lines that weren't KEY=VALUE.
+func newCmd(ctx context.Context, cmd string, opts Options) (c *exec.Cmd, skipped []string, err error) {
+	c = exec.CommandContext(ctx, opts.shell(), "-c", cmd)
+
+	if opts.Dir != "" {
+		dir, err := ExpandPath(opts.Dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return nil, nil, errors.New("working directory not found: " + dir)
+		}
+		c.Dir = dir
+	}
+
+	if len(opts.Env) > 0 {
+		var env []string
+		env, skipped = envLines(opts.Env)
+		c.Env = append(os.Environ(), env...)
+	}
+	return c, skipped, nil
+}
+
+// envLines splits env lines into KEY=VALUE pairs and the non-blank lines
+// that aren't
+func envLines(lines []string) (env, skipped []string) {
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if key, _, ok := strings.Cut(line, "="); !ok || key == "" {
+			skipped = append(skipped, line)
+			continue
+		}
+		env = append(env, line)
+	}
+	return env, skipped
+}
+
+// Interactive returns the process for a command that needs the terminal,
+// like ssh or vim, to run attached to it instead of streaming its output.
+// References are resolved first. Unlike Run, the process stays in the
+// terminal's process group so it can read from it, and there's no timeout.
+func Interactive(cmd string, opts Options) (*exec.Cmd, error) {
+	ctx := context.Background()
+	if opts.Lookup != nil {
+		resolved, err := resolveRefs(ctx, cmd, opts, nil)
+		if err != nil {
+			return nil, err
+		}
+		cmd = resolved
+	}
+	c, _, err := newCmd(ctx, cmd, opts)
+	return c, err
+}
+
+// TmuxWindow returns a tmux command that runs cmd in a new window named
+// name of the current tmux session, for interactive commands started from
+// inside tmux
+func TmuxWindow(name, cmd string, opts Options) (*exec.Cmd, error) {
+	c, err := Interactive(cmd, opts)
 	if err != nil {
-		output <- OutputMsg{Done: true, ErrMsg: err.Error()}
-	} else {
-		output <- OutputMsg{Done: true}
+		return nil, err
+	}
+	dir := c.Dir
+	if dir == "" {
+		if dir, err = os.Getwd(); err != nil {
+			return nil, err
+		}
+	}
+	args := []string{"new-window", "-n", name, "-c", dir}
+	env, _ := envLines(opts.Env)
+	for _, line := range env {
+		args = append(args, "-e", line)
+	}
+	return exec.Command("tmux", append(args, c.Args...)...), nil
+}
+
+// flushInterval is how long output is collected before it's sent on
+const flushInterval = 50 * time.Millisecond
+
+// batchOutput forwards lines until the channel closes, sending at most one
+// message per flushInterval so a flood of output can't swamp the receiver
+func batchOutput(lines <-chan OutputLine, output chan<- OutputMsg) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch []OutputLine
+	for {
+		select {
+		case l, ok := <-lines:
+			if !ok {
+				if len(batch) > 0 {
+					output <- OutputMsg{Lines: batch}
+				}
+				return
+			}
+			batch = append(batch, l)
+		case <-ticker.C:
+			if len(batch) > 0 {
+				output <- OutputMsg{Lines: batch}
+				batch = nil
+			}
+		}
 	}
 }
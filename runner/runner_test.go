@@ -0,0 +1,134 @@
+package runner
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+
+	"cmdbox/model"
+)
+
+func TestSubstituteParams(t *testing.T) {
+	tests := []struct {
+		name  string
+		cmd   string
+		value string
+		want  string
+	}{
+		{"bare plain", "echo {{v}}", "hello", "echo hello"},
+		{"bare empty", "echo {{v}}", "", "echo ''"},
+		{"bare spaces", "echo {{v}}", "hello world", "echo 'hello world'"},
+		{"bare single quote", "echo {{v}}", "it's", `echo 'it'\''s'`},
+		{"bare double quote", "echo {{v}}", `say "hi"`, `echo 'say "hi"'`},
+		{"bare metacharacters", "echo {{v}}", "a; rm -rf / | cat && $(id) `id` > f", "echo 'a; rm -rf / | cat && $(id) `id` > f'"},
+		{"single quoted plain", "echo '{{v}}'", "hello world", "echo 'hello world'"},
+		{"single quoted quote", "echo '{{v}}'", "it's", `echo 'it'\''s'`},
+		{"single quoted metacharacters", "echo '{{v}}'", "$HOME; `id`", "echo '$HOME; `id`'"},
+		{"double quoted spaces", `echo "{{v}}"`, "hello world", `echo "hello world"`},
+		{"double quoted quote", `echo "{{v}}"`, `say "hi"`, `echo "say \"hi\""`},
+		{"double quoted metacharacters", `echo "{{v}}"`, "$HOME `id` \\", "echo \"\\$HOME \\`id\\` \\\\\""},
+		{"double quoted single quote", `echo "{{v}}"`, "it's", `echo "it's"`},
+		{"after closed quotes", `echo "a" {{v}} 'b'`, "x y", `echo "a" 'x y' 'b'`},
+		{"escaped quote isn't a quote", `echo \' {{v}}`, "x y", `echo \' 'x y'`},
+		{"raw", "grep {{=v}} f", "-i -n", "grep -i -n f"},
+		{"sensitive", "login {{!v}}", "p@ss word", "login 'p@ss word'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SubstituteParams(tt.cmd, map[string]string{"v": tt.value})
+			if got != tt.want {
+				t.Errorf("SubstituteParams(%q) = %q, want %q", tt.cmd, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSubstituteParamsShell checks the shell reads each substituted value
+// back as the literal value, whatever quotes surround the param
+func TestSubstituteParamsShell(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+	values := []string{
+		"plain",
+		"",
+		"hello world",
+		"it's",
+		`say "hi"`,
+		`back\slash`,
+		"$HOME $(id) `id`",
+		"a; b | c && d > e < f",
+		"*?[a]~#!",
+		"line\nbreak",
+	}
+	for _, cmd := range []string{"printf %s {{v}}", "printf %s '{{v}}'", `printf %s "{{v}}"`} {
+		for _, v := range values {
+			final := SubstituteParams(cmd, map[string]string{"v": v})
+			out, err := exec.Command("sh", "-c", final).Output()
+			if err != nil {
+				t.Errorf("%q: %v", final, err)
+				continue
+			}
+			if string(out) != v {
+				t.Errorf("%q printed %q, want %q", final, out, v)
+			}
+		}
+	}
+}
+
+func TestSubstituteParamsLeavesUnknown(t *testing.T) {
+	got := SubstituteParams("echo {{a}} {{b}}", map[string]string{"a": "x"})
+	if want := "echo x {{b}}"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestStripComments(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  string
+		want string
+	}{
+		{"comment lines", "# setup\necho hi\n  # indented\necho bye", "echo hi\necho bye"},
+		{"trailing hash kept", "echo a # not a line comment", "echo a # not a line comment"},
+		{"quoted hash line", "echo 'a\n# inside quotes\nb'", "echo 'a\n# inside quotes\nb'"},
+		{"continued line", "echo a \\\n# continued\necho b", "echo a \\\n# continued\necho b"},
+		{"heredoc", "cat <<EOF\n# kept\nEOF\n# gone", "cat <<EOF\n# kept\nEOF"},
+		{"indented heredoc", "cat <<-'END'\n\t# kept\n\tEND\n# gone", "cat <<-'END'\n\t# kept\n\tEND"},
+		{"here-string", "cat <<<word\n# gone", "cat <<<word"},
+		{"arithmetic shift", "echo $((1<<2))\n# gone\necho hi", "echo $((1<<2))\necho hi"},
+		{"arithmetic shift spaced", "echo $(( (x << 2) + 1 ))\n# gone", "echo $(( (x << 2) + 1 ))"},
+		{"arithmetic command", "((n = 1<<4))\n# gone", "((n = 1<<4))"},
+		{"heredoc after arithmetic", "echo $((1<<2)); cat <<EOF\n# kept\nEOF", "echo $((1<<2)); cat <<EOF\n# kept\nEOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripComments(tt.cmd); got != tt.want {
+				t.Errorf("StripComments(%q) = %q, want %q", tt.cmd, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandOptionsTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		secs int
+		def  time.Duration
+		want time.Duration
+	}{
+		{"unset uses default", 0, time.Minute, time.Minute},
+		{"unset without default", 0, 0, 0},
+		{"own timeout", 5, time.Minute, 5 * time.Second},
+		{"opted out", model.NoTimeout, time.Minute, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := model.Command{TimeoutSecs: tt.secs}
+			got := CommandOptions(c, nil, RunConfig{Timeout: tt.def}).Timeout
+			if got != tt.want {
+				t.Errorf("timeout = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
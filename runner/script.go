@@ -0,0 +1,166 @@
+package runner
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"cmdbox/model"
+)
+
+// ToShellScript turns c into a standalone bash script that prompts for
+// each param with read, so it can be run without cmdbox. Params become
+// p_-prefixed shell variables, quoted to match where they sit in the command, and
+// {{@name}} references call cmdbox run.
+func ToShellScript(c model.Command) string {
+	var b strings.Builder
+	b.WriteString("#!/usr/bin/env bash\n")
+	b.WriteString("# " + c.Name + "\n")
+	if c.Description != "" {
+		b.WriteString("#\n")
+		for _, line := range strings.Split(c.Description, "\n") {
+			b.WriteString(strings.TrimRight("# "+line, " ") + "\n")
+		}
+	}
+	b.WriteString("#\n# Exported from cmdbox\n")
+
+	if params := CommandParams(c); len(params) > 0 {
+		b.WriteString("\n")
+		for _, p := range params {
+			writeParamPrompt(&b, p)
+		}
+	}
+
+	if c.WorkDir != "" || c.Env != "" {
+		b.WriteString("\n")
+	}
+	if c.WorkDir != "" {
+		b.WriteString("cd " + quoteDir(c.WorkDir) + " || exit 1\n")
+	}
+	for _, line := range strings.Split(c.Env, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || key == "" {
+			continue
+		}
+		b.WriteString("export " + key + "=" + shellWord(value) + "\n")
+	}
+
+	cmd := replaceExpanded(c.Cmd, refRegex, func(m []int) (string, bool) {
+		name := strings.TrimSpace(c.Cmd[m[2]:m[3]])
+		return "$(cmdbox run " + ShellQuote(name) + ")", false
+	})
+	cmd = replaceExpanded(cmd, paramRegex, func(m []int) (string, bool) {
+		return "${" + scriptVar(cmd[m[6]:m[7]]) + "}", m[4] >= 0 // {{=param}} is raw
+	})
+	b.WriteString("\n" + cmd + "\n")
+	return b.String()
+}
+
+// StandaloneCommand returns finalCmd, c's command with values already
+// substituted, as it would run from a shell prompt: in c's directory and
+// with its environment, set in a subshell so neither outlasts it
+func StandaloneCommand(c model.Command, values map[string]string, finalCmd string) string {
+	var setup []string
+	if c.WorkDir != "" {
+		setup = append(setup, "cd "+quoteDir(c.WorkDir))
+	}
+	env, _ := envLines(strings.Split(SubstituteParamsRaw(c.Env, values), "\n"))
+	for _, line := range env {
+		key, value, _ := strings.Cut(line, "=")
+		setup = append(setup, "export "+key+"="+ShellQuote(value))
+	}
+	if len(setup) == 0 {
+		return finalCmd
+	}
+	// The command gets lines of its own so a heredoc in it still ends
+	return "(" + strings.Join(setup, " && ") + " || exit\n" + finalCmd + "\n)"
+}
+
+// quoteDir quotes a working directory for the shell, leaving a leading ~/
+// to expand to the home directory
+func quoteDir(dir string) string {
+	if rest, ok := strings.CutPrefix(dir, "~/"); ok {
+		return `"$HOME"/` + ShellQuote(rest)
+	}
+	return ShellQuote(dir)
+}
+
+// writeParamPrompt writes the read that asks for p, showing its choices
+// and default, and hiding the input if it's sensitive. Params with an
+// environment variable are only asked for when it's empty.
+func writeParamPrompt(b *strings.Builder, p ParamInfo) {
+	prompt := p.Name
+	if len(p.Choices) > 0 {
+		prompt += " (" + strings.Join(p.Choices, "|") + ")"
+	}
+	if p.Default != "" {
+		prompt += " [" + p.Default + "]"
+	}
+	prompt += ": "
+
+	name := scriptVar(p.Name)
+	read := fmt.Sprintf("read -r -p %s %s", ShellQuote(prompt), name)
+	if p.Sensitive {
+		read = fmt.Sprintf("read -r -s -p %s %s; echo", ShellQuote(prompt), name)
+	}
+	if p.EnvVar != "" {
+		fmt.Fprintf(b, "%s=$%s\n", name, p.EnvVar)
+		fmt.Fprintf(b, "[ -n \"$%s\" ] || { %s; }\n", name, read)
+	} else {
+		b.WriteString(read + "\n")
+	}
+	if p.Default != "" {
+		fmt.Fprintf(b, "%s=${%s:-%s}\n", name, name, ShellQuote(p.Default))
+	}
+}
+
+// scriptVar is the shell variable holding param name, prefixed so params
+// called PATH, HOME or IFS don't overwrite the real ones
+func scriptVar(name string) string {
+	return "p_" + name
+}
+
+// replaceExpanded replaces each match of re in cmd with the shell
+// expansion returned by expand, quoted so it stays one word wherever it
+// sits, unless raw
+func replaceExpanded(cmd string, re *regexp.Regexp, expand func(m []int) (expr string, raw bool)) string {
+	var b strings.Builder
+	var quote byte
+	last := 0
+	for _, m := range re.FindAllStringSubmatchIndex(cmd, -1) {
+		quote = scanQuotes(cmd[last:m[0]], quote)
+		b.WriteString(cmd[last:m[0]])
+		last = m[1]
+
+		expr, raw := expand(m)
+		switch {
+		case quote == '\'' && raw:
+			expr = "'" + expr + "'"
+		case quote == '\'':
+			expr = `'"` + expr + `"'`
+		case quote == 0 && !raw:
+			expr = `"` + expr + `"`
+		}
+		b.WriteString(expr)
+	}
+	b.WriteString(cmd[last:])
+	return b.String()
+}
+
+// shellWord quotes text as one shell word, turning params in it into
+// variables
+func shellWord(text string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range paramRegex.FindAllStringSubmatchIndex(text, -1) {
+		if m[0] > last {
+			b.WriteString(ShellQuote(text[last:m[0]]))
+		}
+		b.WriteString(`"${` + scriptVar(text[m[6]:m[7]]) + `}"`)
+		last = m[1]
+	}
+	if last < len(text) || last == 0 {
+		b.WriteString(ShellQuote(text[last:]))
+	}
+	return b.String()
+}
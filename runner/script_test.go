@@ -0,0 +1,57 @@
+package runner
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"cmdbox/model"
+)
+
+// TestShellScriptParamNamedLikeEnv checks params named after variables
+// the shell relies on are read into their own variables
+func TestShellScriptParamNamedLikeEnv(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("no bash")
+	}
+	c := model.Command{
+		Name: "clash",
+		Cmd:  `printf '%s|%s|%s' {{PATH}} {{HOME}} "$HOME"; command -v ls >/dev/null`,
+		Env:  "GREETING=hi {{HOME}}",
+	}
+	cmd := exec.Command("bash", "-c", ToShellScript(c))
+	cmd.Env = []string{"PATH=/usr/bin:/bin", "HOME=/home/real"}
+	cmd.Stdin = strings.NewReader("/my/path\n/my/home\n")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("script failed: %v\n%s", err, ToShellScript(c))
+	}
+	if want := "/my/path|/my/home|/home/real"; string(out) != want {
+		t.Errorf("script printed %q, want %q", out, want)
+	}
+}
+
+func TestStandaloneCommand(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+	dir := t.TempDir()
+	c := model.Command{
+		Cmd:     "pwd\nprintf '%s|%s\\n' \"$GREETING\" \"$EMPTY\"\ncat <<EOF\n{{name}}\nEOF",
+		WorkDir: dir,
+		Env:     "GREETING=hi {{name}}; $(id)\n\nEMPTY=",
+	}
+	values := map[string]string{"name": "al"}
+	final := SubstituteParams(c.Cmd, values)
+	out, err := exec.Command("sh", "-c", StandaloneCommand(c, values, final)).Output()
+	if err != nil {
+		t.Fatalf("%v\n%s", err, StandaloneCommand(c, values, final))
+	}
+	if want := dir + "\nhi al; $(id)|\nal\n"; string(out) != want {
+		t.Errorf("printed %q, want %q", out, want)
+	}
+
+	if got := StandaloneCommand(model.Command{Cmd: "ls"}, nil, "ls"); got != "ls" {
+		t.Errorf("without a directory or environment got %q, want the command alone", got)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"cmdbox/config"
+	"cmdbox/db"
+	"cmdbox/runner"
+)
+
+// serveRequest is one line sent to cmdbox serve
+type serveRequest struct {
+	Run    string            `json:"run"`
+	Params map[string]string `json:"params"`
+}
+
+// serveLine is a line of output streamed back while a command runs
+type serveLine struct {
+	Stream string `json:"stream"` // stdout or stderr
+	Line   string `json:"line"`
+}
+
+// serveDone ends the reply to a request
+type serveDone struct {
+	Done       bool   `json:"done"`
+	Cmd        string `json:"cmd,omitempty"`
+	ExitCode   int    `json:"exit_code"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// cliServe listens on a Unix socket, ~/.cmdbox/sock by default, and runs
+// saved commands for whoever connects, so editors and scripts can run
+// them without starting cmdbox each time. Requests are newline-delimited
+// JSON, handled one at a time per connection.
+func cliServe(database *db.DB, args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	socket := fs.String("socket", "", "socket path (default ~/.cmdbox/sock)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	path := *socket
+	if path == "" {
+		dir, err := config.Dir()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		path = filepath.Join(dir, "sock")
+	}
+
+	ln, err := listenSocket(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer os.Remove(path)
+
+	cfg := loadConfig()
+	defaults := runner.RunConfig{
+		Timeout: time.Duration(cfg.DefaultTimeout) * time.Second,
+		Shell:   cfg.DefaultShell,
+	}
+
+	// ctrl+c or a TERM stops accepting and kills running commands
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	fmt.Fprintf(os.Stderr, "Listening on %s\n", path)
+	var wg sync.WaitGroup
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+			serveConn(ctx, database, defaults, conn)
+		}()
+	}
+	wg.Wait()
+	return 0
+}
+
+// listenSocket listens on a Unix socket at path that only the current
+// user can connect to. A socket left behind by a cmdbox that didn't shut
+// down cleanly is replaced; one that's still answering is an error.
+func listenSocket(path string) (net.Listener, error) {
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("cmdbox serve is already running on %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return listenUnix(path)
+}
+
+// serveConn answers the requests on conn until it's closed or ctx is done
+func serveConn(ctx context.Context, database *db.DB, defaults runner.RunConfig, conn net.Conn) {
+	// Closing the connection also unblocks a read waiting on it
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	enc := json.NewEncoder(conn)
+	enc.SetEscapeHTML(false)
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var req serveRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			if enc.Encode(serveDone{Done: true, ExitCode: -1, Error: "bad request: " + err.Error()}) != nil {
+				return
+			}
+			continue
+		}
+		if err := serveRun(ctx, database, defaults, req, enc); err != nil {
+			return
+		}
+	}
+}
+
+// serveRun runs the command named in req, writing its output and result
+// to enc. It only returns an error when the reply can't be written, in
+// which case the command is stopped.
+func serveRun(ctx context.Context, database *db.DB, defaults runner.RunConfig, req serveRequest, enc *json.Encoder) error {
+	fail := func(err error) error {
+		return enc.Encode(serveDone{Done: true, ExitCode: -1, Error: err.Error()})
+	}
+	if req.Run == "" {
+		return fail(errors.New(`no command name in "run"`))
+	}
+	cmd, err := database.GetByName(req.Run)
+	if err != nil {
+		return fail(err)
+	}
+	if cmd.Interactive {
+		return fail(fmt.Errorf("%s is interactive and needs a terminal", cmd.Name))
+	}
+
+	values := make(map[string]string, len(req.Params))
+	for k, v := range req.Params {
+		values[k] = v
+	}
+	params, err := fillParams(*cmd, values)
+	if err != nil {
+		return fail(err)
+	}
+
+	finalCmd := runner.SubstituteParams(runner.StripComments(cmd.Cmd), values)
+	opts := runner.CommandOptions(*cmd, values, defaults)
+	opts.Lookup = database.GetByName
+
+	database.UpdateLastUsed(cmd.ID)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	output := make(chan runner.OutputMsg)
+	go runner.Run(ctx, finalCmd, opts, output)
+
+	histCmd := runner.SubstituteParams(runner.StripComments(cmd.Cmd), runner.MaskSensitive(params, values))
+	var writeErr error
+	for msg := range output {
+		if writeErr != nil {
+			continue // drain until Run has stopped the command
+		}
+		for _, l := range msg.Lines {
+			stream := "stdout"
+			if l.IsErr {
+				stream = "stderr"
+			}
+			if writeErr = enc.Encode(serveLine{Stream: stream, Line: l.Text}); writeErr != nil {
+				cancel()
+				break
+			}
+		}
+		if !msg.Done || writeErr != nil {
+			continue
+		}
+
+		database.AddHistory(cmd.ID, histCmd, histCmd != finalCmd, msg.ExitCode)
+		done := serveDone{Done: true, Cmd: histCmd, ExitCode: msg.ExitCode, DurationMs: msg.Duration.Milliseconds(), Error: msg.ErrMsg}
+		if msg.Interrupted {
+			done.Error = "interrupted"
+		}
+		writeErr = enc.Encode(done)
+	}
+	return writeErr
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenUnix listens on a Unix socket at path that's created with mode
+// 0600, so there's no moment when other users could connect to it
+func listenUnix(path string) (net.Listener, error) {
+	old := syscall.Umask(0177)
+	defer syscall.Umask(old)
+	return net.Listen("unix", path)
+}
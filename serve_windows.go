@@ -0,0 +1,11 @@
+//go:build windows
+
+package main
+
+import "net"
+
+// listenUnix listens on a Unix socket at path. Windows has no umask; the
+// socket gets the permissions of the directory it's in.
+func listenUnix(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
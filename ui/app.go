@@ -1,10 +1,20 @@
 package ui
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
+	"cmdbox/config"
 	"cmdbox/db"
 	"cmdbox/model"
 	"cmdbox/runner"
@@ -14,6 +24,8 @@ import (
 	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
 	"github.com/sahilm/fuzzy"
 )
 
@@ -25,6 +37,10 @@ const (
 	modeEdit
 	modeDelete
 	modeParam
+	modeHelp
+	modeConfirmQuery
+	modeView
+	modeConfirmBatch
 )
 
 type tab int
@@ -32,51 +48,158 @@ type tab int
 const (
 	tabBash tab = iota
 	tabSQL
+	tabHistory
 )
 
+// tabState is the position and search of a tab while another is shown
+type tabState struct {
+	cursor int
+	offset int
+	search string
+}
+
+// tabIDs name the tabs in state.json, index for index
+var tabIDs = []string{"bash", "sql", "history"}
+
+// historyLimit caps how many past runs the History tab loads
+const historyLimit = 500
+
 type App struct {
 	db       *db.DB
+	keys     config.KeyMap
 	commands []model.Command
 	filtered []model.Command
 
+	showArchived bool // list archived commands instead of the rest
+
+	// Recently used commands pinned above the list. When shown, they are
+	// repeated as the first pinned entries of filtered.
+	recent      []model.Command
+	recentLimit int
+	pinned      int
+
+	// Fuzzy matches behind filtered and filteredQueries, index for index;
+	// nil when there is no search text
+	matches      []fuzzy.Match
+	queryMatches []fuzzy.Match
+
+	// Category sidebar (Bash tab)
+	categories   []string // every category path, parents included
+	category     string   // selected category; empty shows all
+	sidebarFocus bool
+
 	// SQL queries
 	queries         []model.Query
 	filteredQueries []model.Query
 
+	// Execution history
+	history         []model.HistoryEntry
+	filteredHistory []model.HistoryEntry
+
 	// UI state
 	mode     mode
 	tab      tab
+	tabState [3]tabState // where each tab was left, restored on switching back
 	cursor   int
+	offset   int // index of the first visible list item
+	order    db.Order
 	width    int
 	height   int
 	err      string
 	status   string
+	info     string // muted notice, e.g. when an action had nothing to do
+
+	paramFilter paramFilter // narrows the Bash list by whether commands have params
+
+	// Commands marked with M, run one after another with the run key
+	marked map[int64]bool
 
 	// Search
 	searchInput textinput.Model
 
+	// Full text of the selected item, shown with V
+	viewer      viewport.Model
+	viewerTitle string
+	viewerText  string
+
 	// Output
-	output      viewport.Model
-	outputLines []string
-	running     bool
-	outputChan  chan runner.OutputMsg
+	output       viewport.Model
+	outputLines  []string
+	displayLines []string // outputLines as drawn, see fitOutputLine
+	displayWidth int      // wrap width displayLines were fitted to, 0 when not wrapping
+	outputFocus  bool     // keys scroll the output instead of moving the list
+	wrap         bool     // wrap long lines to the pane width
+	appendRuns   bool     // each command run adds to the output instead of replacing it
+	maxOutput    int      // most lines kept; older ones are dropped
+	droppedLines int      // lines dropped from the current output
+	running      bool
+	outputChan   chan runner.OutputMsg
+	cancelRun    context.CancelFunc
+	queryRows    []runner.Row // result of the last query run
+	outputName   string       // name of the command or query that produced the output
+
+	// The run in progress, recorded to history when it finishes
+	runCmdID    int64
+	runHistCmd  string    // final command with sensitive values masked
+	runRedacted bool      // whether runHistCmd has any masked values
+	runStarted  time.Time // for the elapsed time shown while running
+	runSeq      int       // counts runs, so a finished run's ticks are ignored
+
+	// A batch of marked commands in progress
+	batch          []batchRun // commands still to run
+	batchTotal     int        // commands in the batch; 0 when none is running
+	batchFailed    int
+	batchOnFailure string // "ask", "stop" or "continue"
 
 	// Form (add/edit)
 	formInputs   []textinput.Model
 	sqlTextarea  textarea.Model
+	cmdTextarea  textarea.Model
+	envTextarea  textarea.Model
 	formFocus    int
 	editingCmd   *model.Command
 	editingQuery *model.Query
 
+	// Set while an edited command's changes are shown before saving
+	reviewingEdit   bool
+	formInteractive bool // the Bash form's interactive toggle
+
 	// Param input (inline mode)
-	paramInfos  []runner.ParamInfo
-	paramValues map[string]string
-	paramInput  textinput.Model
-	pendingCmd  *model.Command
+	paramInfos   []runner.ParamInfo
+	paramValues  map[string]string
+	paramInput   textinput.Model
+	paramHistory map[string][]string // recent values per param, newest first
+	pendingCmd   *model.Command
+	pendingQuery *model.Query
+	fullQuery    bool              // pendingQuery loads every row, ignoring queryLimit
+	queryLimit   int               // most rows a SELECT loads unless run in full; 0 for no limit
+	previewRun   bool              // pendingCmd runs without updating last-used or saved params
+	copyRun      bool              // pendingCmd is copied to the clipboard, substituted, instead of run
+	lastRun      *model.Command    // most recent command run this session
+	lastValues   map[string]string // param values lastRun was run with
+	secretKey    []byte            // encrypts remembered sensitive values; nil when disabled
+	runConfig    runner.RunConfig  // timeout and shell for commands without their own
+
+	// Param input (field mode): one input per param, in paramInfos order
+	paramFields     []textinput.Model
+	paramFocus      int
+	paramFieldMode  bool
+	preferParamForm bool // field mode chosen with ctrl+t; sensitive params always start in it
+
+	// Param values each query was last run with, kept for the session
+	queryValues map[int64]map[string]string
 }
 
-func NewApp(database *db.DB) (*App, error) {
-	commands, err := database.List()
+// NewApp creates the TUI. secretKey unlocks saved sensitive param values;
+// when nil they are never remembered.
+func NewApp(database *db.DB, cfg config.Config, secretKey []byte) (*App, error) {
+	theme, err := config.LoadTheme()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: using default theme: %v\n", err)
+	}
+	setupStyles(theme)
+
+	commands, err := database.List(db.OrderRecent)
 	if err != nil {
 		return nil, err
 	}
@@ -86,21 +209,55 @@ func NewApp(database *db.DB) (*App, error) {
 		return nil, err
 	}
 
+	history, err := database.ListHistory(historyLimit)
+	if err != nil {
+		return nil, err
+	}
+
 	search := textinput.New()
 	search.Placeholder = "Search commands..."
 	search.Focus()
+	// Names are suggested as you type; right accepts, see acceptSuggestion
+	search.ShowSuggestions = true
+	search.CompletionStyle = mutedStyle
+	search.KeyMap.AcceptSuggestion.SetEnabled(false)
+	search.KeyMap.NextSuggestion.SetEnabled(false)
+	search.KeyMap.PrevSuggestion.SetEnabled(false)
 
 	output := viewport.New(80, 10)
+	output.SetHorizontalStep(8)
 
 	app := &App{
 		db:              database,
+		keys:            cfg.Keys,
+		secretKey:       secretKey,
+		maxOutput:       cfg.MaxOutputLines,
+		recentLimit:     cfg.RecentCommands,
+		batchOnFailure:  cfg.BatchOnFailure,
+		queryLimit:      cfg.QueryPreviewLimit,
 		commands:        commands,
 		filtered:        commands,
 		queries:         queries,
 		filteredQueries: queries,
+		history:         history,
+		filteredHistory: history,
 		searchInput:     search,
 		output:          output,
+		viewer:          viewport.New(0, 0),
 		paramValues:     make(map[string]string),
+		runConfig: runner.RunConfig{
+			Timeout: time.Duration(cfg.DefaultTimeout) * time.Second,
+			Shell:   cfg.DefaultShell,
+		},
+	}
+
+	app.refreshCategories()
+	app.restoreState()
+	if wrap, _ := database.Setting("wrap_output"); wrap == "true" {
+		app.wrap = true
+	}
+	if fields, _ := database.Setting("param_fields"); fields == "true" {
+		app.preferParamForm = true
 	}
 
 	return app, nil
@@ -112,39 +269,118 @@ func (a *App) Init() tea.Cmd {
 
 type outputMsg runner.OutputMsg
 
+// queryResultMsg carries the result of a query started by runSelectedQuery
+type queryResultMsg struct {
+	rows  []runner.Row
+	err   error
+	limit int // rows were cut to this many by the preview limit; 0 if all came back
+}
+
 func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	// Whatever moved the cursor, resized the list or filtered it, the
+	// cursor stays on screen
+	defer a.scrollToCursor()
+
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
 		a.width = msg.Width - 4  // account for app padding
 		a.height = msg.Height - 2 // account for app padding
-		a.output.Width = a.width - 4
-		a.output.Height = a.height / 3
+		// Keep the panes valid even when the terminal is too small to show
+		a.output.Width = max(a.width-4, 1)
+		a.output.Height = max(a.height/3, 1)
+		if a.wrap {
+			a.setOutput()
+		}
+		if a.mode == modeView {
+			a.layoutViewer()
+		}
 		return a, nil
 
 	case outputMsg:
 		if msg.Done {
 			a.running = false
 			a.outputChan = nil
-			if msg.ErrMsg != "" {
+			if a.cancelRun != nil {
+				a.cancelRun()
+				a.cancelRun = nil
+			}
+			if msg.Interrupted {
+				a.outputLines = append(a.outputLines, mutedStyle.Render("^C interrupted"))
+			} else if msg.ErrMsg != "" {
 				a.outputLines = append(a.outputLines, errorStyle.Render("Error: "+msg.ErrMsg))
+			} else {
+				a.outputLines = append(a.outputLines, exitSummary(msg.ExitCode, msg.Duration))
+			}
+			if err := a.db.AddHistory(a.runCmdID, a.runHistCmd, a.runRedacted, msg.ExitCode); err != nil {
+				a.err = "Failed to record history: " + err.Error()
 			}
-			a.output.SetContent(strings.Join(a.outputLines, "\n"))
+			var next tea.Cmd
+			if a.batchTotal > 0 {
+				next = a.continueBatch(msg)
+			}
+			a.refreshHistory()
+			a.setOutput()
 			a.output.GotoBottom()
-			return a, nil
+			return a, next
 		}
-		line := msg.Line
-		if msg.IsErr {
-			line = errorStyle.Render(line)
+		lines := make([]string, len(msg.Lines))
+		for i, l := range msg.Lines {
+			lines[i] = l.Text
+			if l.IsErr {
+				lines[i] = errorStyle.Render(l.Text)
+			}
 		}
-		a.outputLines = append(a.outputLines, line)
-		a.output.SetContent(strings.Join(a.outputLines, "\n"))
+		a.appendOutput(lines...)
+		a.setOutput()
 		a.output.GotoBottom()
 		// Keep reading from channel
 		return a, waitForOutput(a.outputChan)
 
+	case editorDoneMsg:
+		return a, a.finishEditing(msg)
+
+	case interactiveDoneMsg:
+		a.finishInteractive(msg)
+		return a, nil
+
+	case runTickMsg:
+		// Let the chain end once its run is over
+		if !a.running || msg.seq != a.runSeq {
+			return a, nil
+		}
+		return a, tickRun(msg.seq)
+
+	case pagerDoneMsg:
+		if msg.err != nil {
+			a.err = "Pager failed: " + msg.err.Error()
+		}
+		return a, nil
+
+	case queryResultMsg:
+		a.running = false
+		if a.cancelRun != nil {
+			a.cancelRun()
+			a.cancelRun = nil
+		}
+		if errors.Is(msg.err, context.Canceled) {
+			a.outputLines = append(a.outputLines, mutedStyle.Render("^C interrupted"))
+		} else if msg.err != nil {
+			a.outputLines = append(a.outputLines, errorStyle.Render("Error: "+msg.err.Error()))
+		} else {
+			a.queryRows = msg.rows
+			a.outputLines = append(a.outputLines, strings.Split(renderResult(msg.rows, a.output.Width), "\n")...)
+			if msg.limit > 0 {
+				a.outputLines = append(a.outputLines, warningStyle.Render(fmt.Sprintf("Showing the first %d rows; press F to run the query in full", msg.limit)))
+			}
+		}
+		a.setOutput()
+		a.output.GotoTop()
+		return a, nil
+
 	case tea.KeyMsg:
 		a.err = ""
 		a.status = ""
+		a.info = ""
 
 		switch a.mode {
 		case modeNormal:
@@ -155,6 +391,14 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return a.updateDelete(msg)
 		case modeParam:
 			return a.updateParam(msg)
+		case modeHelp:
+			return a.updateHelp(msg)
+		case modeConfirmQuery:
+			return a.updateConfirmQuery(msg)
+		case modeView:
+			return a.updateViewer(msg)
+		case modeConfirmBatch:
+			return a.updateConfirmBatch(msg)
 		}
 	}
 
@@ -162,23 +406,40 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 func (a *App) updateNormal(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if a.sidebarFocus {
+		if m, cmd, ok := a.updateSidebar(msg); ok {
+			return m, cmd
+		}
+	}
+	if a.outputFocus {
+		if m, cmd, ok := a.updateOutputPane(msg); ok {
+			return m, cmd
+		}
+	}
+
 	switch msg.String() {
-	case "ctrl+c", "Q":
-		return a, tea.Quit
+	case "ctrl+c", a.keys.Quit:
+		return a, a.quit()
+
+	case "ctrl+x":
+		a.stopRunning()
+		return a, nil
+
+	case "ctrl+o":
+		a.outputFocus = true
+		a.sidebarFocus = false
+		return a, nil
+
+	case "?":
+		a.mode = modeHelp
+		return a, nil
+
+	case "ctrl+r":
+		return a.rerunLast()
 
 	case "tab":
-		a.cursor = 0
-		a.searchInput.SetValue("")
-		a.outputLines = []string{}
-		a.output.SetContent("")
-		if a.tab == tabBash {
-			a.tab = tabSQL
-			a.searchInput.Placeholder = "Search queries..."
-		} else {
-			a.tab = tabBash
-			a.searchInput.Placeholder = "Search commands..."
-		}
-		a.filterItems()
+		a.sidebarFocus = false
+		a.switchTab((a.tab + 1) % tab(len(tabIDs)))
 		return a, nil
 
 	case "up", "k":
@@ -192,37 +453,112 @@ func (a *App) updateNormal(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			a.cursor++
 		}
 
-	case "enter":
-		if a.tab == tabBash {
-			if len(a.filtered) > 0 {
-				return a.runSelectedCommand()
+	case "pgup", "ctrl+b":
+		a.cursor = max(a.cursor-a.listHeight(), 0)
+
+	case "pgdown", "ctrl+f":
+		a.cursor = max(min(a.cursor+a.listHeight(), a.listLen()-1), 0)
+
+	case "home":
+		a.cursor = 0
+
+	case "end", "G":
+		a.cursor = max(a.listLen()-1, 0)
+
+	case a.keys.Run:
+		if a.listLen() == 0 {
+			return a, nil
+		}
+		switch a.tab {
+		case tabBash:
+			if len(a.marked) > 0 {
+				return a.startBatch()
 			}
-		} else {
-			// SQL tab: show query in output, don't execute
-			if len(a.filteredQueries) > 0 {
-				q := a.filteredQueries[a.cursor]
-				a.outputLines = []string{q.SQL}
-				a.output.SetContent(q.SQL)
-				a.db.UpdateQueryLastUsed(q.ID)
-				a.refreshQueries()
+			return a.runSelectedCommand(false)
+		case tabSQL:
+			return a.runSelectedQuery(false)
+		case tabHistory:
+			return a.rerunHistory()
+		}
+		return a, nil
+
+	case "F":
+		// Run a query without the preview row limit
+		if a.tab == tabSQL && a.listLen() > 0 {
+			return a.runSelectedQuery(true)
+		}
+		return a, nil
+
+	case "ctrl+y":
+		// Copy the command ready to run, asking for its params first
+		if a.tab == tabBash && a.listLen() > 0 {
+			// Only cmdbox can fill in references
+			if cmd := a.filtered[a.cursor]; runner.HasRefs(cmd.Cmd) {
+				a.err = "'" + cmd.Name + "' uses {{@...}} references, so it can't be copied; run it instead"
+				return a, nil
 			}
+			a.copyRun = true
+			return a.runSelectedCommand(true)
+		}
+		return a, nil
+
+	case "alt+enter":
+		// Show a command off without touching its last-used time or params
+		if a.tab == tabBash && a.listLen() > 0 {
+			return a.runSelectedCommand(true)
+		}
+		return a, nil
+
+	case a.keys.Add:
+		if a.tab == tabHistory {
+			return a, nil
+		}
+		a.mode = modeAdd
+		if a.tab == tabBash {
+			a.initForm(nil)
+		} else {
+			a.initQueryForm(nil)
 		}
 		return a, nil
 
-	case "A":
+	case "ctrl+v":
+		// Start a new command or query from the clipboard, leaving the
+		// name to fill in
+		if a.tab == tabHistory {
+			return a, nil
+		}
+		text, err := clipboard.ReadAll()
+		if err != nil {
+			a.err = "Failed to paste: " + err.Error()
+			return a, nil
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			a.info = "Clipboard is empty"
+			return a, nil
+		}
 		a.mode = modeAdd
 		if a.tab == tabBash {
 			a.initForm(nil)
+			a.cmdTextarea.SetValue(text)
 		} else {
 			a.initQueryForm(nil)
+			a.sqlTextarea.SetValue(text)
 		}
 		return a, nil
 
-	case "E":
+	case a.keys.Edit:
+		if a.tab == tabHistory {
+			return a, nil
+		}
 		if a.tab == tabBash {
 			if len(a.filtered) > 0 {
-				a.mode = modeEdit
 				cmd := a.filtered[a.cursor]
+				if cmd.Locked {
+					a.err = "'" + cmd.Name + "' is locked; press K to unlock it"
+					return a, nil
+				}
+				a.mode = modeEdit
 				a.editingCmd = &cmd
 				a.initForm(&cmd)
 			}
@@ -236,18 +572,34 @@ func (a *App) updateNormal(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		}
 		return a, nil
 
-	case "D":
-		if a.listLen() > 0 {
+	case a.keys.Delete:
+		if a.listLen() > 0 && a.tab != tabHistory {
+			if a.tab == tabBash && a.filtered[a.cursor].Locked {
+				a.err = "'" + a.filtered[a.cursor].Name + "' is locked; press K to unlock it"
+				return a, nil
+			}
 			a.mode = modeDelete
 		}
 		return a, nil
 
+	case "H":
+		if a.showSidebar() {
+			a.sidebarFocus = true
+			a.outputFocus = false
+		}
+		return a, nil
+
+	case "L":
+		a.sidebarFocus = false
+		return a, nil
+
 	case "C":
-		a.outputLines = []string{}
+		a.resetOutput()
+		a.queryRows = nil
 		a.output.SetContent("")
 		return a, nil
 
-	case "Y":
+	case a.keys.Yank:
 		if a.tab == tabBash {
 			if len(a.filtered) > 0 {
 				cmd := a.filtered[a.cursor]
@@ -257,6 +609,15 @@ func (a *App) updateNormal(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 					a.status = "Copied!"
 				}
 			}
+		} else if a.tab == tabHistory {
+			if len(a.filteredHistory) > 0 {
+				h := a.filteredHistory[a.cursor]
+				if err := clipboard.WriteAll(h.FinalCmd); err != nil {
+					a.err = "Failed to copy: " + err.Error()
+				} else {
+					a.status = "Copied!"
+				}
+			}
 		} else {
 			if len(a.filteredQueries) > 0 {
 				q := a.filteredQueries[a.cursor]
@@ -269,10 +630,194 @@ func (a *App) updateNormal(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		}
 		return a, nil
 
+	case "Z":
+		if a.tab == tabBash && len(a.filtered) > 0 {
+			cmd := a.filtered[a.cursor]
+			if err := a.db.SetArchived(cmd.ID, !cmd.Archived); err != nil {
+				a.err = "Failed to archive: " + err.Error()
+				return a, nil
+			}
+			if cmd.Archived {
+				a.status = "Restored '" + cmd.Name + "'"
+			} else {
+				a.status = "Archived '" + cmd.Name + "'"
+			}
+			a.refreshCommands()
+		}
+		return a, nil
+
+	case "K":
+		if a.tab == tabBash && len(a.filtered) > 0 {
+			cmd := a.filtered[a.cursor]
+			if err := a.db.SetLocked(cmd.ID, !cmd.Locked); err != nil {
+				a.err = "Failed to lock: " + err.Error()
+				return a, nil
+			}
+			if cmd.Locked {
+				a.status = "Unlocked '" + cmd.Name + "'"
+			} else {
+				a.status = "Locked '" + cmd.Name + "'"
+			}
+			a.refreshCommands()
+		}
+		return a, nil
+
+	case "M":
+		if a.tab == tabBash && len(a.filtered) > 0 {
+			a.toggleMark()
+		}
+		return a, nil
+
+	case "ctrl+z":
+		if a.tab == tabBash {
+			a.showArchived = !a.showArchived
+			a.cursor = 0
+			a.offset = 0
+			a.refreshCommands()
+		}
+		return a, nil
+
+	case "ctrl+s":
+		a.order = a.order.Next()
+		a.status = "Sorted by " + a.order.String()
+		a.refreshCommands()
+		return a, nil
+
+	case "ctrl+p":
+		if a.tab == tabBash {
+			a.paramFilter = a.paramFilter.next()
+			a.status = "Showing commands " + a.paramFilter.String()
+			if a.paramFilter == paramFilterOff {
+				a.status = "Showing all commands"
+			}
+			a.cursor = 0
+			a.offset = 0
+			a.filterCommands()
+		}
+		return a, nil
+
+	case "ctrl+up", "ctrl+down":
+		if a.tab == tabBash {
+			delta := 1
+			if msg.String() == "ctrl+up" {
+				delta = -1
+			}
+			a.moveCommand(delta)
+		}
+		return a, nil
+
+	case "ctrl+l":
+		a.wrap = !a.wrap
+		a.setOutput()
+		if err := a.db.SetSetting("wrap_output", strconv.FormatBool(a.wrap)); err != nil {
+			a.err = "Failed to save wrap setting: " + err.Error()
+		} else if a.wrap {
+			a.status = "Wrapping output"
+		} else {
+			a.status = "Not wrapping output"
+		}
+		return a, nil
+
+	case "ctrl+n":
+		a.appendRuns = !a.appendRuns
+		if a.appendRuns {
+			a.status = "Runs add to the output"
+		} else {
+			a.status = "Runs replace the output"
+		}
+		return a, nil
+
+	case "O":
+		if len(a.outputLines) == 0 {
+			a.info = "Nothing to copy"
+		} else if err := clipboard.WriteAll(a.plainOutput()); err != nil {
+			a.err = "Failed to copy: " + err.Error()
+		} else {
+			a.status = "Output copied!"
+		}
+		return a, nil
+
+	case "P":
+		if len(a.outputLines) == 0 {
+			a.info = "Nothing to page"
+			return a, nil
+		}
+		return a, a.openPager()
+
+	case "W":
+		if len(a.outputLines) == 0 {
+			a.info = "Nothing to save"
+			return a, nil
+		}
+		path, err := writeOutput(a.outputName, a.outputLines)
+		if err != nil {
+			a.err = "Failed to save output: " + err.Error()
+		} else {
+			a.status = "Saved to " + path
+		}
+		return a, nil
+
+	case "R":
+		if a.tab != tabSQL {
+			return a, nil
+		}
+		if len(a.queryRows) == 0 {
+			a.info = "No query results to save"
+			return a, nil
+		}
+		path, err := writeDataFile("query", a.outputName, ".csv", runner.QueryResultToCSV(a.queryRows))
+		if err != nil {
+			a.err = "Failed to save CSV: " + err.Error()
+		} else {
+			a.status = "Saved to " + path
+		}
+		return a, nil
+
+	case "V":
+		a.openViewer()
+		return a, nil
+
+	case "B":
+		if a.tab != tabBash || len(a.filtered) == 0 {
+			return a, nil
+		}
+		path, err := writeScript(a.filtered[a.cursor])
+		if err != nil {
+			a.err = "Failed to save script: " + err.Error()
+		} else {
+			a.status = "Saved to " + path
+		}
+		return a, nil
+
+	case "X":
+		path, stripped, err := a.exportLibrary()
+		if err != nil {
+			a.err = "Export failed: " + err.Error()
+		} else {
+			a.status = "Exported to " + path
+			if stripped > 0 {
+				a.info = fmt.Sprintf("Connection passwords left out of %d queries; use cmdbox export --include-secrets to keep them", stripped)
+			}
+		}
+		return a, nil
+
 	case "esc":
+		// With no search to clear, esc clears the marks
+		if a.searchInput.Value() == "" {
+			a.marked = nil
+		}
 		a.searchInput.SetValue("")
 		a.filterItems()
 
+	case "right":
+		if a.acceptSuggestion() {
+			return a, nil
+		}
+		var cmd tea.Cmd
+		a.searchInput, cmd = a.searchInput.Update(msg)
+		a.filterItems()
+		return a, cmd
+
 	default:
 		var cmd tea.Cmd
 		a.searchInput, cmd = a.searchInput.Update(msg)
@@ -283,24 +828,274 @@ func (a *App) updateNormal(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return a, nil
 }
 
+// resetOutput replaces the output pane's lines
+func (a *App) resetOutput(lines ...string) {
+	a.outputLines = lines
+	a.displayLines = nil
+	a.droppedLines = 0
+}
+
+// appendOutput adds lines to the output pane, dropping the oldest once
+// there are more than maxOutput. Reslicing lets append reclaim the dropped
+// lines the next time it grows the array, so memory stays bounded.
+func (a *App) appendOutput(lines ...string) {
+	a.outputLines = append(a.outputLines, lines...)
+	if over := len(a.outputLines) - a.maxOutput; over > 0 {
+		a.outputLines = a.outputLines[over:]
+		a.displayLines = a.displayLines[min(over, len(a.displayLines)):]
+		a.droppedLines += over
+	}
+}
+
+// setOutput fills the output pane from outputLines. Only lines added since
+// the last call are fitted, unless wrap or the pane width changed.
+func (a *App) setOutput() {
+	width := 0
+	if a.wrap {
+		width = max(a.output.Width, 0)
+	}
+	if width != a.displayWidth {
+		a.displayLines = nil
+		a.displayWidth = width
+	}
+	for _, l := range a.outputLines[len(a.displayLines):] {
+		a.displayLines = append(a.displayLines, fitOutputLine(l, width))
+	}
+
+	content := strings.Join(a.displayLines, "\n")
+	if a.droppedLines > 0 {
+		content = mutedStyle.Render("... (truncated)") + "\n" + content
+	}
+	a.output.SetContent(content)
+}
+
+// maxLineWidth is the most of a line the output pane shows when not
+// wrapping. Cutting pathological lines, like minified JSON, keeps drawing
+// the pane fast; the full line is still copied and saved.
+const maxLineWidth = 1000
+
+// fitOutputLine prepares line for the output pane: wrapped to wrapWidth,
+// or when that's 0, cut at maxLineWidth with a note of how much is hidden
+func fitOutputLine(line string, wrapWidth int) string {
+	if wrapWidth > 0 {
+		return ansi.Wrap(line, wrapWidth, "")
+	}
+	// A line has at least as many bytes as cells, so most skip measuring
+	if len(line) <= maxLineWidth {
+		return line
+	}
+	width := ansi.StringWidth(line)
+	if width <= maxLineWidth {
+		return line
+	}
+	return ansi.Truncate(line, maxLineWidth, "") + mutedStyle.Render(fmt.Sprintf("…[+%d chars]", width-maxLineWidth))
+}
+
+// plainOutput returns the output pane's text with styling stripped
+func (a *App) plainOutput() string {
+	lines := make([]string, len(a.outputLines))
+	for i, l := range a.outputLines {
+		lines[i] = ansi.Strip(l)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writeOutput saves lines, with styling stripped, to a timestamped log file
+// in the data directory and returns its path
+func writeOutput(name string, lines []string) (string, error) {
+	var b strings.Builder
+	for _, l := range lines {
+		b.WriteString(ansi.Strip(l))
+		b.WriteString("\n")
+	}
+	return writeDataFile("output", name, ".log", []byte(b.String()))
+}
+
+// writeScript saves cmd as an executable shell script and returns the path
+func writeScript(cmd model.Command) (string, error) {
+	path, err := writeDataFile("script", cmd.Name, ".sh", []byte(runner.ToShellScript(cmd)))
+	if err != nil {
+		return "", err
+	}
+	return path, os.Chmod(path, 0700)
+}
+
+// writeDataFile saves data to ~/.cmdbox/<kind>-<name>-<timestamp><ext>
+// and returns the path
+func writeDataFile(kind, name, ext string, data []byte) (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+
+	filename := kind + "-" + sanitizeFilename(name) + "-" + time.Now().Format("20060102-150405") + ext
+	path := filepath.Join(dir, filename)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// sanitizeFilename reduces s to characters safe in a file name,
+// e.g. "deploy prod/eu" becomes "deploy-prod-eu"
+func sanitizeFilename(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range s {
+		if r < 128 && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+	name := strings.Trim(b.String(), "-.")
+	if name == "" {
+		return "output"
+	}
+	return name
+}
+
+// exportLibrary writes all commands and queries, without connection
+// passwords, to a timestamped JSON file in the data directory. It returns
+// the path and how many connection strings had a password taken out.
+func (a *App) exportLibrary() (string, int, error) {
+	data, stripped, err := a.db.ExportJSON(false)
+	if err != nil {
+		return "", 0, err
+	}
+	dir, err := config.Dir()
+	if err != nil {
+		return "", 0, err
+	}
+	path := filepath.Join(dir, "export-"+time.Now().Format("20060102-150405")+".json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", 0, err
+	}
+	return path, stripped, nil
+}
+
+// stopRunning kills the running command, if any. The runner reports the
+// interruption through its final OutputMsg.
+func (a *App) stopRunning() {
+	if a.running && a.cancelRun != nil {
+		a.cancelRun()
+	}
+}
+
+// setTab switches to t, updating the search placeholder to match
+func (a *App) setTab(t tab) {
+	a.tab = t
+	switch t {
+	case tabBash:
+		a.searchInput.Placeholder = "Search commands..."
+	case tabSQL:
+		a.searchInput.Placeholder = "Search queries..."
+	default:
+		a.searchInput.Placeholder = "Search history..."
+	}
+}
+
+// switchTab shows t as it was left, keeping the current tab's cursor and
+// search for when it's shown again
+func (a *App) switchTab(t tab) {
+	a.tabState[a.tab] = tabState{cursor: a.cursor, offset: a.offset, search: a.searchInput.Value()}
+	a.setTab(t)
+
+	state := a.tabState[t]
+	a.searchInput.SetValue(state.search)
+	a.filterItems()
+	a.cursor = max(min(state.cursor, a.listLen()-1), 0)
+	a.offset = state.offset
+}
+
+// restoreState returns to the tab and cursor saved by the last session,
+// clamping the cursor to the list as it is now
+func (a *App) restoreState() {
+	state, err := config.LoadState()
+	if err != nil {
+		return
+	}
+	if t := slices.Index(tabIDs, state.Tab); t >= 0 {
+		a.setTab(tab(t))
+	}
+	a.cursor = max(min(state.Cursor, a.listLen()-1), 0)
+}
+
+// saveState remembers the tab and cursor for the next session
+func (a *App) saveState() {
+	config.SaveState(config.State{Tab: tabIDs[a.tab], Cursor: a.cursor})
+}
+
+// quit saves the state and exits
+func (a *App) quit() tea.Cmd {
+	a.stopRunning()
+	a.saveState()
+	return tea.Quit
+}
+
 func (a *App) listLen() int {
-	if a.tab == tabBash {
+	switch a.tab {
+	case tabBash:
 		return len(a.filtered)
+	case tabSQL:
+		return len(a.filteredQueries)
+	default:
+		return len(a.filteredHistory)
+	}
+}
+
+// updateOutputPane scrolls the output while it has focus, reporting
+// whether it handled the key. Other keys act as usual.
+func (a *App) updateOutputPane(msg tea.KeyMsg) (tea.Model, tea.Cmd, bool) {
+	switch msg.String() {
+	case "ctrl+o", "esc":
+		a.outputFocus = false
+	case "home", "g":
+		a.output.GotoTop()
+	case "end", "G":
+		a.output.GotoBottom()
+	case "up", "k", "down", "j", "left", "h", "right", "l", "pgup", "pgdown", "ctrl+b", "ctrl+f", "ctrl+u", "ctrl+d":
+		if msg.String() == "ctrl+b" {
+			msg = tea.KeyMsg{Type: tea.KeyPgUp}
+		} else if msg.String() == "ctrl+f" {
+			msg = tea.KeyMsg{Type: tea.KeyPgDown}
+		}
+		var cmd tea.Cmd
+		a.output, cmd = a.output.Update(msg)
+		return a, cmd, true
+	default:
+		return a, nil, false
 	}
-	return len(a.filteredQueries)
+	return a, nil, true
 }
 
 func (a *App) updateForm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	// SQL form has 3 logical fields: name(0), sql(1), desc(2)
-	// Bash form has 3 fields: name(0), cmd(1), desc(2)
-	maxFocus := 2
+	// SQL form has 4 logical fields: name(0), sql(1), desc(2), conn(3)
+	// Bash form has 10 fields: name(0), cmd(1), desc(2), tags(3), category(4),
+	// timeout(5), shell(6), dir(7), label(8), env(9)
+	// SQL has one textarea besides its inputs, Bash has two
+	maxFocus := len(a.formInputs)
 	if a.tab == tabBash {
-		maxFocus = len(a.formInputs) - 1
+		maxFocus++
+	}
+
+	if a.reviewingEdit {
+		switch msg.String() {
+		case "ctrl+c":
+			return a, a.quit()
+		case "S":
+			return a.submitForm()
+		case "esc":
+			a.reviewingEdit = false
+		}
+		return a, nil
 	}
 
 	switch msg.String() {
 	case "ctrl+c":
-		return a, tea.Quit
+		return a, a.quit()
 
 	case "esc":
 		a.mode = modeNormal
@@ -310,6 +1105,15 @@ func (a *App) updateForm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case "S":
 		return a.submitForm()
 
+	case "ctrl+o":
+		return a, a.openEditor()
+
+	case "ctrl+t":
+		if a.tab == tabBash {
+			a.formInteractive = !a.formInteractive
+		}
+		return a, nil
+
 	case "tab", "down":
 		// In SQL textarea, tab inserts tab, use ctrl+n or down to move
 		if a.tab == tabSQL && a.formFocus == 1 && msg.String() == "tab" {
@@ -328,29 +1132,54 @@ func (a *App) updateForm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return a, a.focusFormInput()
 
 	case "enter":
-		if a.tab == tabBash {
-			return a.submitForm()
-		}
-		// SQL tab: enter in textarea adds newline, otherwise submit
-		if a.formFocus == 1 {
+		// Enter in a textarea adds newline, otherwise submit
+		if ta := a.focusedTextarea(); ta != nil {
 			var cmd tea.Cmd
-			a.sqlTextarea, cmd = a.sqlTextarea.Update(msg)
+			*ta, cmd = ta.Update(msg)
 			return a, cmd
 		}
 		return a.submitForm()
 
+	case "left", "right":
+		// The label field cycles through the color palette
+		if a.tab == tabBash && a.focusedTextarea() == nil && a.formInputIndex() == labelInputIndex {
+			delta := 1
+			if msg.String() == "left" {
+				delta = -1
+			}
+			a.formInputs[labelInputIndex].SetValue(cycleLabel(a.formInputs[labelInputIndex].Value(), delta))
+			a.formInputs[labelInputIndex].CursorEnd()
+			return a, nil
+		}
+		fallthrough
+
 	default:
 		var cmd tea.Cmd
-		if a.tab == tabSQL && a.formFocus == 1 {
-			a.sqlTextarea, cmd = a.sqlTextarea.Update(msg)
+		if ta := a.focusedTextarea(); ta != nil {
+			*ta, cmd = ta.Update(msg)
 		} else {
-			idx := a.sqlFormInputIndex()
+			idx := a.formInputIndex()
 			a.formInputs[idx], cmd = a.formInputs[idx].Update(msg)
 		}
 		return a, cmd
 	}
 }
 
+// focusedTextarea returns the form's textarea if it has focus, or nil when
+// a single-line input is focused
+func (a *App) focusedTextarea() *textarea.Model {
+	if a.formFocus == 1 {
+		if a.tab == tabSQL {
+			return &a.sqlTextarea
+		}
+		return &a.cmdTextarea
+	}
+	if a.tab == tabBash && a.formFocus == len(a.formInputs)+1 {
+		return &a.envTextarea
+	}
+	return nil
+}
+
 func (a *App) updateDelete(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "y", "Y":
@@ -389,60 +1218,325 @@ func (a *App) updateDelete(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return a, nil
 	}
 
-	return a, nil
+	return a, nil
+}
+
+func (a *App) updateParam(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if a.paramFieldMode {
+		switch msg.String() {
+		case "tab":
+			return a, a.moveParamFocus(1)
+		case "shift+tab":
+			return a, a.moveParamFocus(-1)
+		}
+	}
+
+	switch msg.String() {
+	case "ctrl+c":
+		return a, a.quit()
+
+	case "esc":
+		// Drop the cancelled run so none of it carries into the next one
+		a.mode = modeNormal
+		a.pendingCmd = nil
+		a.pendingQuery = nil
+		a.paramInfos = nil
+		a.paramValues = nil
+		a.previewRun = false
+		a.copyRun = false
+		a.searchInput.Focus()
+		return a, nil
+
+	case "enter":
+		parsed := a.enteredParams()
+		// Validate all params present
+		var missing []string
+		for _, p := range a.paramInfos {
+			if _, ok := parsed[p.Name]; !ok {
+				missing = append(missing, p.Name)
+			}
+		}
+		if len(missing) > 0 {
+			a.err = "Missing params: " + strings.Join(missing, ", ")
+			return a, nil
+		}
+		for _, p := range a.paramInfos {
+			if err := runner.ValidateParam(p, parsed[p.Name]); err != nil {
+				a.err = err.Error()
+				return a, nil
+			}
+		}
+		a.paramValues = parsed
+		if a.tab == tabSQL {
+			a.mode = modeNormal
+			a.searchInput.Focus()
+			return a.confirmQuery()
+		}
+		return a.executeCommand()
+
+	case "ctrl+d":
+		// Dry run: show what would execute, with secrets masked
+		values := runner.MaskSensitive(a.paramInfos, a.enteredParams())
+		if a.tab == tabSQL {
+			lines := append([]string{mutedStyle.Render("dry run, not executed:")}, strings.Split(highlightSQL(a.pendingQuery.SQL), "\n")...)
+			a.resetOutput(append(lines, a.boundValues(values)...)...)
+		} else {
+			preview := runner.SubstituteParams(runner.StripComments(a.pendingCmd.Cmd), values)
+			a.resetOutput(mutedStyle.Render("dry run, not executed:"), cmdPreviewStyle.Render("$ "+preview))
+		}
+		a.setOutput()
+		a.output.GotoTop()
+		return a, nil
+
+	case "up":
+		a.cycleParam(1)
+		return a, nil
+
+	case "down":
+		a.cycleParam(-1)
+		return a, nil
+
+	case "ctrl+t":
+		values := a.enteredParams()
+		a.paramFieldMode = !a.paramFieldMode
+		a.preferParamForm = a.paramFieldMode
+		if err := a.db.SetSetting("param_fields", strconv.FormatBool(a.paramFieldMode)); err != nil {
+			a.err = "Failed to save param mode: " + err.Error()
+		}
+		return a, a.setParamInputs(values)
+
+	default:
+		var cmd tea.Cmd
+		if a.paramFieldMode {
+			a.paramFields[a.paramFocus], cmd = a.paramFields[a.paramFocus].Update(msg)
+		} else {
+			a.paramInput, cmd = a.paramInput.Update(msg)
+		}
+		return a, cmd
+	}
+}
+
+// enteredParams reads the values typed in param mode, from the inline
+// string or from the per-param inputs
+func (a *App) enteredParams() map[string]string {
+	if !a.paramFieldMode {
+		// Parse inline params: key=value key2=value2
+		return parseInlineParams(a.paramInput.Value())
+	}
+	values := make(map[string]string)
+	for i, p := range a.paramInfos {
+		values[p.Name] = a.paramFields[i].Value()
+	}
+	return values
+}
+
+// paramDescription returns the pending command's description with the
+// values entered so far filled in. Params still empty keep their {{name}}.
+func (a *App) paramDescription() string {
+	desc := ""
+	switch {
+	case a.tab == tabSQL && a.pendingQuery != nil:
+		desc = a.pendingQuery.Description
+	case a.tab != tabSQL && a.pendingCmd != nil:
+		desc = a.pendingCmd.Description
+	}
+	if desc == "" {
+		return ""
+	}
+	entered := a.enteredParams()
+	masked := runner.MaskSensitive(a.paramInfos, entered)
+	values := make(map[string]string)
+	for name, v := range entered {
+		if v != "" {
+			values[name] = masked[name]
+		}
+	}
+	return runner.SubstituteParamsRaw(desc, values)
+}
+
+// setParamInputs fills the inline input and the per-param inputs with
+// values and focuses whichever the current mode shows
+func (a *App) setParamInputs(values map[string]string) tea.Cmd {
+	var parts []string
+	a.paramFields = make([]textinput.Model, len(a.paramInfos))
+	for i, p := range a.paramInfos {
+		parts = append(parts, p.Name+"="+quoteInlineValue(values[p.Name]))
+
+		field := textinput.New()
+		field.Prompt = ""
+		field.SetValue(values[p.Name])
+		if p.Sensitive {
+			field.EchoMode = textinput.EchoPassword
+		}
+		a.paramFields[i] = field
+	}
+
+	a.paramInput = textinput.New()
+	a.paramInput.SetValue(strings.Join(parts, " "))
+	// Position cursor at end
+	a.paramInput.CursorEnd()
+
+	a.paramFocus = 0
+	return a.focusParamInput()
 }
 
-func (a *App) updateParam(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch msg.String() {
-	case "ctrl+c":
-		return a, tea.Quit
-
-	case "esc":
-		a.mode = modeNormal
-		a.searchInput.Focus()
-		return a, nil
+// lockIcon marks sensitive params in the param prompt, and locked commands
+// in the list
+const lockIcon = "🔒"
 
-	case "enter":
-		// Parse inline params: key=value key2=value2
-		parsed := parseInlineParams(a.paramInput.Value())
-		// Validate all params present
-		var missing []string
-		for _, p := range a.paramInfos {
-			if _, ok := parsed[p.Name]; !ok {
-				missing = append(missing, p.Name)
-			}
+// sensitiveNote explains what happens to sensitive values, or is empty if
+// the pending command has none
+func (a *App) sensitiveNote() string {
+	for _, p := range a.paramInfos {
+		if !p.Sensitive {
+			continue
 		}
-		if len(missing) > 0 {
-			a.err = "Missing params: " + strings.Join(missing, ", ")
-			return a, nil
+		if a.secretKey != nil {
+			return mutedStyle.Render("(" + lockIcon + " sensitive, saved encrypted)")
 		}
-		a.paramValues = parsed
-		return a.executeCommand()
+		return mutedStyle.Render("(" + lockIcon + " sensitive, not saved between runs)")
+	}
+	return ""
+}
 
-	default:
-		var cmd tea.Cmd
-		a.paramInput, cmd = a.paramInput.Update(msg)
-		return a, cmd
+// cycleParam replaces the focused param's value with an older (delta 1) or
+// newer (delta -1) one from its history. In inline mode the param is the
+// key=value pair under the cursor.
+func (a *App) cycleParam(delta int) {
+	if a.paramFieldMode {
+		field := &a.paramFields[a.paramFocus]
+		name := a.paramInfos[a.paramFocus].Name
+		field.SetValue(recentValue(a.paramHistory[name], field.Value(), delta))
+		return
+	}
+
+	runes := []rune(a.paramInput.Value())
+	pos := a.paramInput.Position()
+	for _, p := range splitInlineParams(a.paramInput.Value()) {
+		if pos < p.start || pos > p.end || !p.ok {
+			continue
+		}
+		pair := []rune(p.key + "=" + quoteInlineValue(recentValue(a.paramHistory[p.key], p.value, delta)))
+		a.paramInput.SetValue(string(runes[:p.start]) + string(pair) + string(runes[p.end:]))
+		a.paramInput.SetCursor(p.start + len(pair))
+		return
 	}
 }
 
+// recentValue steps delta places through recent from value. A value not in
+// recent steps back to the newest one; stepping past either end keeps value.
+func recentValue(recent []string, value string, delta int) string {
+	i := slices.Index(recent, value)
+	switch {
+	case i < 0 && delta > 0 && len(recent) > 0:
+		return recent[0]
+	case i >= 0 && i+delta >= 0 && i+delta < len(recent):
+		return recent[i+delta]
+	}
+	return value
+}
+
+// moveParamFocus moves between the per-param inputs, wrapping around
+func (a *App) moveParamFocus(delta int) tea.Cmd {
+	n := len(a.paramFields)
+	a.paramFocus = (a.paramFocus + delta + n) % n
+	return a.focusParamInput()
+}
+
+func (a *App) focusParamInput() tea.Cmd {
+	a.paramInput.Blur()
+	for i := range a.paramFields {
+		a.paramFields[i].Blur()
+	}
+	if a.paramFieldMode {
+		return a.paramFields[a.paramFocus].Focus()
+	}
+	return a.paramInput.Focus()
+}
+
 // parseInlineParams parses "key=value key2=value2" into map
 func parseInlineParams(input string) map[string]string {
 	result := make(map[string]string)
-	parts := strings.Fields(input)
-	for _, part := range parts {
-		if idx := strings.Index(part, "="); idx > 0 {
-			key := part[:idx]
-			value := part[idx+1:]
-			result[key] = value
+	for _, p := range splitInlineParams(input) {
+		if p.ok && p.key != "" {
+			result[p.key] = p.value
 		}
 	}
 	return result
 }
 
-func (a *App) runSelectedCommand() (tea.Model, tea.Cmd) {
+// inlineParam is one space-separated word of the inline param input,
+// runes start to end of it. ok is false when it has no =.
+type inlineParam struct {
+	key, value string
+	start, end int
+	ok         bool
+}
+
+// splitInlineParams splits the inline param input into key=value words.
+// Quotes let a value hold spaces: msg="hello world" or msg='hello world'.
+// Inside double quotes \" and \\ stand for " and \; single quotes keep
+// everything as typed. An unclosed quote runs to the end of the input.
+func splitInlineParams(input string) []inlineParam {
+	var params []inlineParam
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		if runes[i] == ' ' || runes[i] == '\t' {
+			i++
+			continue
+		}
+
+		start := i
+		var word strings.Builder
+		var quote rune
+		for ; i < len(runes); i++ {
+			r := runes[i]
+			if quote == 0 && (r == ' ' || r == '\t') {
+				break
+			}
+			switch {
+			case quote == 0 && (r == '"' || r == '\''):
+				quote = r
+			case r == quote:
+				quote = 0
+			case quote == '"' && r == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\'):
+				i++
+				word.WriteRune(runes[i])
+			default:
+				word.WriteRune(r)
+			}
+		}
+
+		key, value, ok := strings.Cut(word.String(), "=")
+		params = append(params, inlineParam{key: key, value: value, start: start, end: i, ok: ok})
+	}
+	return params
+}
+
+// quoteInlineValue double-quotes value for the inline param input if it
+// has spaces or quotes, so splitInlineParams reads it back unchanged
+func quoteInlineValue(value string) string {
+	if !strings.ContainsAny(value, " \t\"'") {
+		return value
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// runSelectedCommand runs the selected command, asking for its params
+// first. A preview run leaves its last-used time and saved params alone.
+func (a *App) runSelectedCommand(preview bool) (tea.Model, tea.Cmd) {
+	// A second run would orphan the first, which ctrl+x could then no
+	// longer stop. Copying doesn't run anything, so it's fine.
+	if a.running && !a.copyRun {
+		a.err = "A command is already running"
+		return a, nil
+	}
 	cmd := a.filtered[a.cursor]
-	params := runner.ExtractParams(cmd.Cmd)
+	params := runner.CommandParams(cmd)
+	a.previewRun = preview
+	// Params of an earlier run would be saved against this command
+	a.paramInfos = nil
+	a.paramValues = nil
 
 	if len(params) > 0 {
 		a.mode = modeParam
@@ -450,66 +1544,441 @@ func (a *App) runSelectedCommand() (tea.Model, tea.Cmd) {
 		a.paramValues = make(map[string]string)
 		a.pendingCmd = &cmd
 
-		// Load last-used values
-		lastParams := make(map[string]string)
-		if cmd.LastParams != "" {
-			json.Unmarshal([]byte(cmd.LastParams), &lastParams)
-		}
+		saved := a.savedParamValues(cmd, params)
+
+		// Sensitive params are left out of the history, so it's safe to load
+		a.paramHistory, _ = a.db.ParamHistory(cmd.ID)
 
-		// Build inline input: "key=value key2=value2"
-		var parts []string
+		// Sensitive values are only hidden as you type in field mode
+		a.paramFieldMode = a.preferParamForm
+		values := make(map[string]string)
+		// Params all filled from the environment don't need asking for
+		allFromEnv := true
 		for _, p := range params {
-			val := ""
-			if !p.Sensitive {
-				val = lastParams[p.Name]
+			val := saved[p.Name]
+			if p.Sensitive {
+				a.paramFieldMode = true
+			}
+			env := p.FromEnv()
+			if val == "" {
+				val = env
+			}
+			if val == "" || val != env || runner.ValidateParam(p, val) != nil {
+				allFromEnv = false
 			}
-			parts = append(parts, p.Name+"="+val)
+			if val == "" {
+				val = p.Default
+			}
+			values[p.Name] = val
 		}
-
-		a.paramInput = textinput.New()
-		a.paramInput.SetValue(strings.Join(parts, " "))
-		a.paramInput.Focus()
-		// Position cursor at end
-		a.paramInput.CursorEnd()
-		return a, nil
+		if allFromEnv {
+			a.paramValues = values
+			return a.executeCommand()
+		}
+		return a, a.setParamInputs(values)
 	}
 
 	a.pendingCmd = &cmd
 	return a.executeCommand()
 }
 
+// savedParamValues returns the values params were last run with for cmd.
+// Sensitive values come from the encrypted store; ones that can't be
+// decrypted are treated as never saved.
+func (a *App) savedParamValues(cmd model.Command, params []runner.ParamInfo) map[string]string {
+	values := make(map[string]string)
+	if cmd.LastParams != "" {
+		json.Unmarshal([]byte(cmd.LastParams), &values)
+	}
+	var secrets map[string]string
+	if a.secretKey != nil {
+		secrets, _ = a.db.LoadEncryptedParams(cmd.ID, a.secretKey)
+	}
+	for _, p := range params {
+		if !p.Sensitive {
+			continue
+		}
+		if v, ok := secrets[p.Name]; ok {
+			values[p.Name] = v
+		} else {
+			delete(values, p.Name)
+		}
+	}
+	return values
+}
+
 func (a *App) executeCommand() (tea.Model, tea.Cmd) {
 	cmd := a.pendingCmd
-	finalCmd := runner.SubstituteParams(cmd.Cmd, a.paramValues)
+	finalCmd := runner.SubstituteParams(runner.StripComments(cmd.Cmd), a.paramValues)
+
+	finalEnv := runner.SubstituteParamsRaw(cmd.Env, a.paramValues)
+	if left := runner.FindUnsubstituted(finalCmd + "\n" + finalEnv); len(left) > 0 {
+		a.err = "Unfilled params: " + strings.Join(left, ", ")
+		return a, nil
+	}
+
+	if a.copyRun {
+		return a.copyCommand(runner.StandaloneCommand(*cmd, a.paramValues, finalCmd))
+	}
 
-	a.db.UpdateLastUsed(cmd.ID)
+	if !a.previewRun {
+		a.db.UpdateLastUsed(cmd.ID)
+	}
 
-	// Save non-sensitive params
-	if len(a.paramInfos) > 0 {
+	// Save non-sensitive params, and sensitive ones encrypted if enabled
+	if len(a.paramInfos) > 0 && !a.previewRun {
 		toSave := make(map[string]string)
+		secrets := make(map[string]string)
 		for _, p := range a.paramInfos {
-			if !p.Sensitive {
-				if v, ok := a.paramValues[p.Name]; ok {
+			// Values from the environment are read again next time
+			if env := p.FromEnv(); env != "" && a.paramValues[p.Name] == env {
+				continue
+			}
+			if v, ok := a.paramValues[p.Name]; ok {
+				if p.Sensitive {
+					secrets[p.Name] = v
+				} else {
 					toSave[p.Name] = v
 				}
 			}
 		}
-		a.db.SaveLastParams(cmd.ID, toSave)
+		// With every param sensitive or from the environment there's
+		// nothing to save, and saving {} would wipe what's stored
+		if len(toSave) > 0 {
+			a.db.SaveLastParams(cmd.ID, toSave)
+			a.db.AddParamHistory(cmd.ID, toSave)
+		}
+		if a.secretKey != nil && len(secrets) > 0 {
+			if err := a.db.SaveEncryptedParams(cmd.ID, secrets, a.secretKey); err != nil {
+				a.err = "Failed to save secrets: " + err.Error()
+			}
+		}
 	}
 
-	a.running = true
-	a.outputLines = []string{cmdPreviewStyle.Render("$ " + finalCmd), ""}
-	a.output.SetContent(strings.Join(a.outputLines, "\n"))
+	a.lastRun = cmd
+	a.lastValues = a.paramValues
 
 	a.mode = modeNormal
 	a.searchInput.Focus()
 	a.refreshCommands() // reload to get updated last_params
 
+	histCmd := runner.SubstituteParams(runner.StripComments(cmd.Cmd), runner.MaskSensitive(a.paramInfos, a.paramValues))
+	return a, a.startRun(*cmd, finalCmd, histCmd, a.paramValues)
+}
+
+// copyCommand puts the pending command, with its params substituted and
+// its directory and environment set up, on the clipboard in place of
+// running it. Sensitive values are copied too,
+// since a runnable command is what was asked for.
+func (a *App) copyCommand(finalCmd string) (tea.Model, tea.Cmd) {
+	a.copyRun = false
+	a.mode = modeNormal
+	a.searchInput.Focus()
+	if err := clipboard.WriteAll(finalCmd); err != nil {
+		a.err = "Failed to copy: " + err.Error()
+		return a, nil
+	}
+	a.status = "Copied!"
+	for _, p := range a.paramInfos {
+		if p.Sensitive {
+			a.info = "The copy includes sensitive values in plain text"
+			break
+		}
+	}
+	return a, nil
+}
+
+// runNote marks the param prompt of a run that won't be an ordinary one,
+// or is empty
+func (a *App) runNote() string {
+	switch {
+	case a.copyRun:
+		return "(copy, not run)"
+	case a.previewRun:
+		return "(preview run)"
+	}
+	return ""
+}
+
+// startRun streams finalCmd into the output pane using cmd's run options,
+// with values substituted into its environment. histCmd is what gets
+// recorded in history once the run finishes.
+func (a *App) startRun(cmd model.Command, finalCmd, histCmd string, values map[string]string) tea.Cmd {
+	if cmd.Interactive {
+		return a.runInteractive(cmd, finalCmd, histCmd, values)
+	}
+	a.running = true
+	a.outputName = cmd.Name
+	a.runCmdID = cmd.ID
+	a.runHistCmd = histCmd
+	a.runRedacted = histCmd != finalCmd
+	a.queryRows = nil
+	// Echo the masked command so sensitive values stay off screen
+	echo := cmdPreviewStyle.Render("$ " + histCmd)
+	switch {
+	case a.batchTotal > 0:
+		if len(a.outputLines) > 0 {
+			a.appendOutput("")
+		}
+		a.appendOutput(a.batchHeader(cmd.Name), echo, "")
+	case a.appendRuns && len(a.outputLines) > 0:
+		header := fmt.Sprintf("── %s · %s ──", cmd.Name, time.Now().Format("15:04:05"))
+		a.appendOutput("", mutedStyle.Render(header), echo, "")
+	default:
+		a.resetOutput(echo, "")
+	}
+	a.setOutput()
+
 	// Start command in goroutine
+	ctx, cancel := context.WithCancel(context.Background())
+	a.cancelRun = cancel
 	a.outputChan = make(chan runner.OutputMsg)
-	go runner.Run(finalCmd, a.outputChan)
+	opts := runner.CommandOptions(cmd, values, a.runConfig)
+	opts.Lookup = a.db.GetByName
+	go runner.Run(ctx, finalCmd, opts, a.outputChan)
+
+	a.runStarted = time.Now()
+	a.runSeq++
+	return tea.Batch(waitForOutput(a.outputChan), tickRun(a.runSeq))
+}
+
+// runTickMsg redraws the elapsed time of run seq
+type runTickMsg struct {
+	seq int
+}
+
+// tickRun schedules the next elapsed-time redraw for run seq
+func tickRun(seq int) tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg {
+		return runTickMsg{seq: seq}
+	})
+}
+
+// formatElapsed renders d as "00:14", or "1:02:03" past an hour
+func formatElapsed(d time.Duration) string {
+	secs := int(d.Seconds())
+	if secs >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", secs/3600, secs/60%60, secs%60)
+	}
+	return fmt.Sprintf("%02d:%02d", secs/60, secs%60)
+}
+
+// humanizeTime renders how long ago t was, like "5m ago" or "3d ago", or
+// "never" for nil
+func humanizeTime(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	d := time.Since(*t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	case d < 30*24*time.Hour:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	case d < 365*24*time.Hour:
+		return fmt.Sprintf("%dmo ago", int(d.Hours()/24/30))
+	default:
+		return fmt.Sprintf("%dy ago", int(d.Hours()/24/365))
+	}
+}
+
+// rerunLast runs the last command of this session again with the same
+// param values, skipping the prompt
+func (a *App) rerunLast() (tea.Model, tea.Cmd) {
+	if a.lastRun == nil {
+		a.info = "No previous command"
+		return a, nil
+	}
+	if a.running {
+		a.err = "A command is already running"
+		return a, nil
+	}
+
+	a.pendingCmd = a.lastRun
+	a.previewRun = false
+	a.paramInfos = runner.CommandParams(*a.lastRun)
+	a.paramValues = a.lastValues
+	return a.executeCommand()
+}
+
+// rerunHistory runs the selected history entry's command verbatim, using
+// the original command's options if it still exists
+func (a *App) rerunHistory() (tea.Model, tea.Cmd) {
+	if a.running {
+		a.err = "A command is already running"
+		return a, nil
+	}
+
+	h := a.filteredHistory[a.cursor]
+	if h.Redacted {
+		a.err = "This run has redacted values; run it from the Bash tab"
+		return a, nil
+	}
+	cmd := model.Command{ID: h.CommandID}
+	for _, c := range a.commands {
+		if c.ID == h.CommandID {
+			cmd = c
+			break
+		}
+	}
+
+	// The environment isn't stored in history; fill it from the last run
+	lastParams := make(map[string]string)
+	if cmd.LastParams != "" {
+		json.Unmarshal([]byte(cmd.LastParams), &lastParams)
+	}
+	return a, a.startRun(cmd, h.FinalCmd, h.FinalCmd, lastParams)
+}
+
+// runSelectedQuery runs the selected query, asking for its params first.
+// Values are remembered for the rest of the session, not saved.
+func (a *App) runSelectedQuery(full bool) (tea.Model, tea.Cmd) {
+	if a.running {
+		a.err = "A command is already running"
+		return a, nil
+	}
+	q := a.filteredQueries[a.cursor]
+	if q.ConnString == "" {
+		a.err = "No connection set for this query (press E to add one)"
+		return a, nil
+	}
+	a.pendingQuery = &q
+	// Params of an earlier run would be listed as bound to this one
+	a.paramInfos = nil
+	a.paramValues = nil
+	a.fullQuery = full
+
+	params := runner.ExtractQueryParams(q.SQL)
+	if len(params) == 0 {
+		return a.confirmQuery()
+	}
+
+	a.mode = modeParam
+	a.paramInfos = params
+	a.paramHistory = nil
+	a.previewRun = false
+	a.paramFieldMode = a.preferParamForm
+	values := make(map[string]string)
+	for _, p := range params {
+		val := a.queryValues[q.ID][p.Name]
+		if p.Sensitive {
+			a.paramFieldMode = true
+		}
+		if val == "" {
+			val = p.FromEnv()
+		}
+		if val == "" {
+			val = p.Default
+		}
+		values[p.Name] = val
+	}
+	return a, a.setParamInputs(values)
+}
+
+// confirmQuery runs the pending query, asking first if it may change data
+func (a *App) confirmQuery() (tea.Model, tea.Cmd) {
+	if !runner.IsReadOnlyQuery(a.pendingQuery.SQL) {
+		a.mode = modeConfirmQuery
+		return a, nil
+	}
+	return a.startQuery(*a.pendingQuery, a.paramValues)
+}
+
+// updateConfirmQuery asks before running a query that may change data
+func (a *App) updateConfirmQuery(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "y", "Y":
+		a.mode = modeNormal
+		return a.startQuery(*a.pendingQuery, a.paramValues)
+
+	case "n", "N", "esc":
+		a.mode = modeNormal
+	}
+	return a, nil
+}
+
+// writeKinds names the statements in sql that may change data, e.g.
+// "DELETE" or "UPDATE/DROP"
+func writeKinds(sql string) string {
+	var kinds []string
+	for _, kind := range runner.StatementKinds(sql) {
+		if runner.IsReadOnlyQuery(kind) {
+			continue
+		}
+		if kind == "" {
+			kind = "unrecognized"
+		}
+		if !slices.Contains(kinds, kind) {
+			kinds = append(kinds, kind)
+		}
+	}
+	return strings.Join(kinds, "/")
+}
+
+// startQuery runs q with values bound to its params
+func (a *App) startQuery(q model.Query, values map[string]string) (tea.Model, tea.Cmd) {
+	a.db.UpdateQueryLastUsed(q.ID)
+	a.refreshQueries()
+	if len(values) > 0 {
+		if a.queryValues == nil {
+			a.queryValues = make(map[int64]map[string]string)
+		}
+		a.queryValues[q.ID] = values
+	}
+
+	a.queryRows = nil
+	a.outputName = q.Name
+	lines := strings.Split(highlightSQL(q.SQL), "\n")
+	lines = append(lines, a.boundValues(runner.MaskSensitive(a.paramInfos, values))...)
+	a.resetOutput(append(lines, "")...)
+	a.setOutput()
+
+	// One row past the limit shows whether it cut anything off
+	query, limit := q.SQL, 0
+	if !a.fullQuery && a.queryLimit > 0 {
+		if limited := runner.ApplyPreviewLimit(q.SQL, a.queryLimit+1); limited != q.SQL {
+			query, limit = limited, a.queryLimit
+		}
+	}
+	// The query counts as running, so ctrl+x and quitting cancel it
+	ctx, cancel := context.WithCancel(context.Background())
+	a.cancelRun = cancel
+	a.running = true
+	a.runStarted = time.Now()
+	a.runSeq++
+	return a, tea.Batch(func() tea.Msg {
+		rows, err := runner.RunQuery(ctx, q.ConnString, query, values)
+		if limit > 0 && len(rows) > limit {
+			return queryResultMsg{rows: rows[:limit], err: err, limit: limit}
+		}
+		return queryResultMsg{rows: rows, err: err}
+	}, tickRun(a.runSeq))
+}
 
-	return a, waitForOutput(a.outputChan)
+// boundValues lists the values bound to the pending query's params, one
+// "-- name = value" line each, in param order
+func (a *App) boundValues(values map[string]string) []string {
+	var lines []string
+	for _, p := range a.paramInfos {
+		if v, ok := values[p.Name]; ok {
+			lines = append(lines, mutedStyle.Render("-- "+p.Name+" = "+v))
+		}
+	}
+	return lines
+}
+
+// exitSummary renders the line shown when a command finishes,
+// e.g. "✔ exited 0 in 1.2s"
+func exitSummary(code int, d time.Duration) string {
+	text := fmt.Sprintf("exited %d in %.1fs", code, d.Seconds())
+	if code == 0 {
+		return successStyle.Render("✔ " + text)
+	}
+	return errorStyle.Render("✘ " + text)
 }
 
 func waitForOutput(ch chan runner.OutputMsg) tea.Cmd {
@@ -523,33 +1992,85 @@ func waitForOutput(ch chan runner.OutputMsg) tea.Cmd {
 }
 
 func (a *App) initForm(cmd *model.Command) {
-	a.formInputs = make([]textinput.Model, 3)
+	a.formInputs = make([]textinput.Model, 8)
 
 	nameInput := textinput.New()
-	nameInput.Placeholder = "Name (e.g., deploy prod)"
+	nameInput.Placeholder = "Name (e.g., deploy prod; made from the command if left blank)"
 	nameInput.Focus()
 
-	cmdInput := textinput.New()
-	cmdInput.Placeholder = "Command (use {{param}} for dynamic values)"
+	cmdArea := textarea.New()
+	cmdArea.Placeholder = "Command (use {{param}} for dynamic values)"
+	cmdArea.ShowLineNumbers = false
+	cmdArea.SetHeight(3)
 
 	descInput := textinput.New()
 	descInput.Placeholder = "Description (optional)"
 
+	tagsInput := textinput.New()
+	tagsInput.Placeholder = "Tags (optional, comma-separated)"
+
+	categoryInput := textinput.New()
+	categoryInput.Placeholder = "Category (optional, e.g. infra/aws)"
+
+	timeoutInput := textinput.New()
+	timeoutInput.Placeholder = "Timeout in seconds (optional, 0 = none)"
+	if t := a.runConfig.Timeout; t > 0 {
+		timeoutInput.Placeholder = fmt.Sprintf("Timeout in seconds (optional, defaults to %d, 0 = none)", int(t.Seconds()))
+	}
+
+	shellInput := textinput.New()
+	shellInput.Placeholder = "Shell (optional, e.g. /bin/zsh; defaults to $SHELL)"
+	if sh := a.runConfig.Shell; sh != "" {
+		shellInput.Placeholder = "Shell (optional, defaults to " + sh + ")"
+	}
+
+	dirInput := textinput.New()
+	dirInput.Placeholder = "Working directory (optional, e.g. ~/code/app)"
+
+	labelInput := textinput.New()
+	labelInput.Placeholder = "Label (optional, ←/→ to pick a color, or type an emoji)"
+
+	envArea := textarea.New()
+	envArea.Placeholder = "AWS_PROFILE={{profile}}\nKUBECONFIG=~/.kube/dev"
+	envArea.ShowLineNumbers = false
+	envArea.SetHeight(3)
+
 	if cmd != nil {
 		nameInput.SetValue(cmd.Name)
-		cmdInput.SetValue(cmd.Cmd)
+		cmdArea.SetValue(cmd.Cmd)
 		descInput.SetValue(cmd.Description)
+		tagsInput.SetValue(strings.ReplaceAll(cmd.Tags, ",", ", "))
+		categoryInput.SetValue(cmd.Category)
+		switch {
+		case cmd.TimeoutSecs > 0:
+			timeoutInput.SetValue(strconv.Itoa(cmd.TimeoutSecs))
+		case cmd.TimeoutSecs == model.NoTimeout:
+			timeoutInput.SetValue("0")
+		}
+		shellInput.SetValue(cmd.Shell)
+		dirInput.SetValue(cmd.WorkDir)
+		labelInput.SetValue(cmd.Label)
+		envArea.SetValue(cmd.Env)
 	}
 
 	a.formInputs[0] = nameInput
-	a.formInputs[1] = cmdInput
-	a.formInputs[2] = descInput
+	a.formInputs[1] = descInput
+	a.formInputs[2] = tagsInput
+	a.formInputs[3] = categoryInput
+	a.formInputs[4] = timeoutInput
+	a.formInputs[5] = shellInput
+	a.formInputs[6] = dirInput
+	a.formInputs[labelInputIndex] = labelInput
+	a.cmdTextarea = cmdArea
+	a.envTextarea = envArea
 	a.formFocus = 0
 	a.editingQuery = nil
+	a.reviewingEdit = false
+	a.formInteractive = cmd != nil && cmd.Interactive
 }
 
 func (a *App) initQueryForm(q *model.Query) {
-	a.formInputs = make([]textinput.Model, 2)
+	a.formInputs = make([]textinput.Model, 3)
 
 	nameInput := textinput.New()
 	nameInput.Placeholder = "Name (e.g., users by date)"
@@ -558,6 +2079,9 @@ func (a *App) initQueryForm(q *model.Query) {
 	descInput := textinput.New()
 	descInput.Placeholder = "Description (optional)"
 
+	connInput := textinput.New()
+	connInput.Placeholder = "Connection (postgres://, mysql:// or sqlite://)"
+
 	// SQL textarea
 	sqlArea := textarea.New()
 	sqlArea.Placeholder = "SELECT * FROM ..."
@@ -568,10 +2092,12 @@ func (a *App) initQueryForm(q *model.Query) {
 		nameInput.SetValue(q.Name)
 		sqlArea.SetValue(q.SQL)
 		descInput.SetValue(q.Description)
+		connInput.SetValue(q.ConnString)
 	}
 
 	a.formInputs[0] = nameInput
 	a.formInputs[1] = descInput
+	a.formInputs[2] = connInput
 	a.sqlTextarea = sqlArea
 	a.formFocus = 0
 	a.editingCmd = nil
@@ -582,25 +2108,22 @@ func (a *App) focusFormInput() tea.Cmd {
 		a.formInputs[i].Blur()
 	}
 	a.sqlTextarea.Blur()
+	a.cmdTextarea.Blur()
+	a.envTextarea.Blur()
 
-	if a.tab == tabSQL && a.formFocus == 1 {
-		// Focus SQL textarea (index 1 in SQL form is textarea)
-		return a.sqlTextarea.Focus()
+	if ta := a.focusedTextarea(); ta != nil {
+		return ta.Focus()
 	}
-	return a.formInputs[a.sqlFormInputIndex()].Focus()
+	return a.formInputs[a.formInputIndex()].Focus()
 }
 
-// sqlFormInputIndex maps formFocus to formInputs index for SQL form
-// SQL form: 0=name, 1=textarea, 2=description
-// formInputs only has [name, description] for SQL
-func (a *App) sqlFormInputIndex() int {
-	if a.tab != tabSQL {
-		return a.formFocus
-	}
+// formInputIndex maps formFocus to a formInputs index. Both forms have a
+// textarea at focus 1 that isn't in formInputs.
+func (a *App) formInputIndex() int {
 	if a.formFocus == 0 {
 		return 0 // name
 	}
-	return 1 // description (formFocus 2 -> index 1)
+	return a.formFocus - 1 // skip the textarea
 }
 
 func (a *App) submitForm() (tea.Model, tea.Cmd) {
@@ -612,11 +2135,30 @@ func (a *App) submitForm() (tea.Model, tea.Cmd) {
 
 func (a *App) submitCommandForm() (tea.Model, tea.Cmd) {
 	name := strings.TrimSpace(a.formInputs[0].Value())
-	cmd := strings.TrimSpace(a.formInputs[1].Value())
-	desc := strings.TrimSpace(a.formInputs[2].Value())
+	cmd := strings.TrimSpace(a.cmdTextarea.Value())
+	desc := strings.TrimSpace(a.formInputs[1].Value())
+
+	if cmd == "" {
+		a.err = "A command is required"
+		return a, nil
+	}
+
+	tags := normalizeTags(a.formInputs[2].Value())
+	category := normalizeCategory(a.formInputs[3].Value())
+
+	timeout, err := parseTimeout(a.formInputs[4].Value())
+	if err != nil {
+		a.err = "Timeout must be a whole number of seconds"
+		return a, nil
+	}
 
-	if name == "" || cmd == "" {
-		a.err = "Name and command are required"
+	shell := strings.TrimSpace(a.formInputs[5].Value())
+	workDir := strings.TrimSpace(a.formInputs[6].Value())
+	label := normalizeLabel(a.formInputs[labelInputIndex].Value())
+	env := strings.TrimSpace(a.envTextarea.Value())
+
+	if bad := runner.FindMalformed(runner.StripComments(cmd) + "\n" + env); len(bad) > 0 {
+		a.err = "Malformed params, write them as {{name}}: " + strings.Join(bad, ", ")
 		return a, nil
 	}
 
@@ -625,13 +2167,31 @@ func (a *App) submitCommandForm() (tea.Model, tea.Cmd) {
 		excludeID = a.editingCmd.ID
 	}
 
-	dupName, err := a.db.IsDuplicateName(name, excludeID)
+	derived := name == ""
+	if derived {
+		// Add a counter when the name is taken, e.g. "git log 2"
+		base := deriveName(cmd)
+		name = base
+		for n := 2; ; n++ {
+			existing, err := a.db.DuplicateName(name, excludeID)
+			if err != nil {
+				a.err = err.Error()
+				return a, nil
+			}
+			if existing == "" {
+				break
+			}
+			name = fmt.Sprintf("%s %d", base, n)
+		}
+	}
+
+	dupName, err := a.db.DuplicateName(name, excludeID)
 	if err != nil {
 		a.err = err.Error()
 		return a, nil
 	}
-	if dupName {
-		a.err = "A command with this name already exists"
+	if dupName != "" {
+		a.err = fmt.Sprintf("A command named '%s' already exists", dupName)
 		return a, nil
 	}
 
@@ -641,25 +2201,61 @@ func (a *App) submitCommandForm() (tea.Model, tea.Cmd) {
 		return a, nil
 	}
 	if dupCmd {
-		a.err = "A command with this exact command already exists"
+		a.err = "A command with the same command already exists"
 		return a, nil
 	}
 
+	// Show what changed in the command before an edit is saved
+	if a.mode == modeEdit && !a.reviewingEdit && cmd != a.editingCmd.Cmd {
+		a.reviewingEdit = true
+		return a, nil
+	}
+	a.reviewingEdit = false
+
+	c := model.Command{
+		Name:        name,
+		Cmd:         cmd,
+		Description: desc,
+		Tags:        tags,
+		TimeoutSecs: timeout,
+		Shell:       shell,
+		WorkDir:     workDir,
+		Env:         env,
+		Category:    category,
+		Label:       label,
+		Interactive: a.formInteractive,
+	}
 	if a.mode == modeAdd {
-		_, err = a.db.Add(name, cmd, desc)
+		_, err = a.db.Add(c)
 		if err != nil {
 			a.err = err.Error()
 			return a, nil
 		}
 		a.status = "Added!"
 	} else {
-		err = a.db.Update(a.editingCmd.ID, name, cmd, desc)
+		c.ID = a.editingCmd.ID
+		err = a.db.Update(c)
 		if err != nil {
 			a.err = err.Error()
 			return a, nil
 		}
 		a.status = "Updated!"
 	}
+	if derived {
+		a.status += fmt.Sprintf(" Named '%s'.", name)
+	}
+	// Show what will be asked for, to catch a misspelt param early
+	if params := runner.CommandParams(c); len(params) > 0 {
+		names := make([]string, len(params))
+		for i, p := range params {
+			names[i] = p.Name
+		}
+		a.status += " Params: " + strings.Join(names, ", ")
+	}
+
+	if runner.HasSubstitution(c.Cmd) {
+		a.info = "Note: this command runs $(...) or `...` substitutions, so its output can change from run to run"
+	}
 
 	a.refreshCommands()
 	a.mode = modeNormal
@@ -667,10 +2263,68 @@ func (a *App) submitCommandForm() (tea.Model, tea.Cmd) {
 	return a, nil
 }
 
+// deriveNameWords is how many words of a command deriveName keeps
+const deriveNameWords = 3
+
+// deriveName makes a name for a command saved without one from its program
+// and the words after it, e.g. "kubectl get pods" for
+// "KUBECONFIG=dev sudo /usr/bin/kubectl get pods -n {{ns}} | grep api".
+// It stops at params, pipes, redirects and separators.
+func deriveName(cmd string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(runner.StripComments(cmd)), "\n")
+	var words []string
+	for _, w := range strings.Fields(line) {
+		if len(words) == 0 && (w == "sudo" || w == "env" || strings.Contains(w, "=")) {
+			continue // env assignments and wrappers before the program
+		}
+		if strings.Contains(w, "{{") {
+			break
+		}
+		i := strings.IndexAny(w, "|&;<>()$`")
+		if i >= 0 {
+			w = w[:i]
+		}
+		if w = strings.Trim(w, `"'`); w != "" {
+			if len(words) == 0 {
+				w = filepath.Base(w)
+			}
+			words = append(words, w)
+		}
+		if i >= 0 || len(words) == deriveNameWords {
+			break
+		}
+	}
+	if len(words) == 0 {
+		return "command"
+	}
+	return strings.Join(words, " ")
+}
+
+// parseTimeout parses the timeout field; empty means the default timeout
+// and 0 means none
+func parseTimeout(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case n < 0:
+		return 0, fmt.Errorf("negative timeout")
+	case n == 0:
+		return model.NoTimeout, nil
+	}
+	return n, nil
+}
+
 func (a *App) submitQueryForm() (tea.Model, tea.Cmd) {
 	name := strings.TrimSpace(a.formInputs[0].Value())
 	sql := a.sqlTextarea.Value() // preserve formatting from textarea
 	desc := strings.TrimSpace(a.formInputs[1].Value())
+	conn := strings.TrimSpace(a.formInputs[2].Value())
 
 	if name == "" || strings.TrimSpace(sql) == "" {
 		a.err = "Name and SQL are required"
@@ -682,13 +2336,13 @@ func (a *App) submitQueryForm() (tea.Model, tea.Cmd) {
 		excludeID = a.editingQuery.ID
 	}
 
-	dupName, err := a.db.IsDuplicateQueryName(name, excludeID)
+	dupName, err := a.db.DuplicateQueryName(name, excludeID)
 	if err != nil {
 		a.err = err.Error()
 		return a, nil
 	}
-	if dupName {
-		a.err = "A query with this name already exists"
+	if dupName != "" {
+		a.err = fmt.Sprintf("A query named '%s' already exists", dupName)
 		return a, nil
 	}
 
@@ -698,19 +2352,21 @@ func (a *App) submitQueryForm() (tea.Model, tea.Cmd) {
 		return a, nil
 	}
 	if dupSQL {
-		a.err = "A query with this exact SQL already exists"
+		a.err = "A query with the same SQL already exists"
 		return a, nil
 	}
 
+	q := model.Query{Name: name, SQL: sql, Description: desc, ConnString: conn}
 	if a.mode == modeAdd {
-		_, err = a.db.AddQuery(name, sql, desc)
+		_, err = a.db.AddQuery(q)
 		if err != nil {
 			a.err = err.Error()
 			return a, nil
 		}
 		a.status = "Added!"
 	} else {
-		err = a.db.UpdateQuery(a.editingQuery.ID, name, sql, desc)
+		q.ID = a.editingQuery.ID
+		err = a.db.UpdateQuery(q)
 		if err != nil {
 			a.err = err.Error()
 			return a, nil
@@ -725,49 +2381,172 @@ func (a *App) submitQueryForm() (tea.Model, tea.Cmd) {
 }
 
 func (a *App) refreshCommands() {
-	commands, err := a.db.List()
+	list := a.db.List
+	if a.showArchived {
+		list = a.db.ListArchived
+	}
+	commands, err := list(a.order)
 	if err != nil {
 		a.err = err.Error()
 		return
 	}
 	a.commands = commands
+	a.recent = nil
+	if a.recentLimit > 0 && !a.showArchived {
+		a.recent, _ = a.db.ListRecent(a.recentLimit)
+	}
+	a.refreshCategories()
 	a.filterCommands()
 }
 
+// moveCommand swaps the selected command with the one delta rows away in
+// the manual order, keeping it selected
+func (a *App) moveCommand(delta int) {
+	switch {
+	case a.order != db.OrderManual:
+		a.info = "Sort manually (ctrl+s) to reorder commands"
+		return
+	case a.searchInput.Value() != "":
+		a.info = "Clear the search to reorder commands"
+		return
+	}
+	to := a.cursor + delta
+	if len(a.filtered) == 0 || to < 0 || to >= len(a.filtered) {
+		return
+	}
+	if err := a.db.Swap(a.filtered[a.cursor].ID, a.filtered[to].ID); err != nil {
+		a.err = err.Error()
+		return
+	}
+	a.refreshCommands()
+	a.cursor = to
+}
+
 func (a *App) refreshQueries() {
 	queries, err := a.db.ListQueries()
 	if err != nil {
 		a.err = err.Error()
 		return
 	}
-	a.queries = queries
-	a.filterQueries()
+	a.queries = queries
+	a.filterQueries()
+}
+
+func (a *App) refreshHistory() {
+	history, err := a.db.ListHistory(historyLimit)
+	if err != nil {
+		a.err = err.Error()
+		return
+	}
+	a.history = history
+	a.filterHistory()
 }
 
 func (a *App) filterItems() {
-	if a.tab == tabBash {
+	switch a.tab {
+	case tabBash:
 		a.filterCommands()
-	} else {
+	case tabSQL:
 		a.filterQueries()
+	default:
+		a.filterHistory()
 	}
+	a.updateSuggestions()
 }
 
-func (a *App) filterCommands() {
+// updateSuggestions offers the names of the matching commands or queries,
+// best match first, to complete the search. The input shows the first
+// that starts with what's typed, and only while the cursor is at the end.
+func (a *App) updateSuggestions() {
+	var names []string
+	atEnd := a.searchInput.Position() == len([]rune(a.searchInput.Value()))
+	switch {
+	case !atEnd:
+	case a.tab == tabBash:
+		for _, c := range a.filtered {
+			names = append(names, c.Name)
+		}
+	case a.tab == tabSQL:
+		for _, q := range a.filteredQueries {
+			names = append(names, q.Name)
+		}
+	}
+	a.searchInput.SetSuggestions(names)
+}
+
+// acceptSuggestion completes the search to the suggested name, reporting
+// whether there was one
+func (a *App) acceptSuggestion() bool {
+	if len(a.searchInput.MatchedSuggestions()) == 0 {
+		return false
+	}
+	name := a.searchInput.CurrentSuggestion()
+	if name == a.searchInput.Value() {
+		return false
+	}
+	a.searchInput.SetValue(name)
+	a.searchInput.CursorEnd()
+	a.filterItems()
+	return true
+}
+
+func (a *App) filterHistory() {
 	query := a.searchInput.Value()
 	if query == "" {
-		a.filtered = a.commands
+		a.filteredHistory = a.history
 		return
 	}
 
 	var targets []string
-	for _, c := range a.commands {
-		targets = append(targets, c.Name+" "+c.Cmd)
+	for _, h := range a.history {
+		targets = append(targets, h.CommandName+" "+h.FinalCmd)
 	}
 
 	matches := fuzzy.Find(query, targets)
-	a.filtered = make([]model.Command, len(matches))
+	a.filteredHistory = make([]model.HistoryEntry, len(matches))
 	for i, m := range matches {
-		a.filtered[i] = a.commands[m.Index]
+		a.filteredHistory[i] = a.history[m.Index]
+	}
+
+	if a.cursor >= len(a.filteredHistory) {
+		a.cursor = max(0, len(a.filteredHistory)-1)
+	}
+}
+
+func (a *App) filterCommands() {
+	filters, query := parseSearch(a.searchInput.Value())
+
+	candidates := a.commands
+	if a.category != "" || !filters.empty() || a.paramFilter != paramFilterOff {
+		candidates = nil
+		for _, c := range a.commands {
+			if inCategory(c, a.category) && filters.match(c) && a.paramFilter.match(c) {
+				candidates = append(candidates, c)
+			}
+		}
+	}
+
+	a.matches = nil
+	a.pinned = 0
+	if query == "" {
+		a.filtered = candidates
+		// Pin the recently used commands on the unfiltered list, unless
+		// it's already sorted that way
+		if filters.empty() && a.category == "" && a.paramFilter == paramFilterOff && a.order != db.OrderRecent && a.order != db.OrderManual && len(a.recent) > 0 {
+			a.pinned = len(a.recent)
+			a.filtered = append(slices.Clone(a.recent), candidates...)
+		}
+	} else {
+		var targets []string
+		for _, c := range candidates {
+			targets = append(targets, c.Name+" "+c.Cmd+" "+c.Description)
+		}
+
+		a.matches = fuzzy.Find(query, targets)
+		a.filtered = make([]model.Command, len(a.matches))
+		for i, m := range a.matches {
+			a.filtered[i] = candidates[m.Index]
+		}
 	}
 
 	if a.cursor >= len(a.filtered) {
@@ -775,8 +2554,152 @@ func (a *App) filterCommands() {
 	}
 }
 
+// paramFilter limits the command list to commands with or without params
+type paramFilter int
+
+const (
+	paramFilterOff     paramFilter = iota
+	paramFilterWith                // only commands that ask for params
+	paramFilterWithout             // only commands that don't
+)
+
+// next returns the filter after f, wrapping around to off
+func (f paramFilter) next() paramFilter {
+	return (f + 1) % (paramFilterWithout + 1)
+}
+
+// String describes the filter for the status bar
+func (f paramFilter) String() string {
+	switch f {
+	case paramFilterWith:
+		return "with params"
+	case paramFilterWithout:
+		return "without params"
+	default:
+		return "all"
+	}
+}
+
+// match reports whether c passes the filter
+func (f paramFilter) match(c model.Command) bool {
+	switch f {
+	case paramFilterWith:
+		return len(runner.CommandParams(c)) > 0
+	case paramFilterWithout:
+		return len(runner.CommandParams(c)) == 0
+	default:
+		return true
+	}
+}
+
+// matchedFrom reports whether any matched byte offset is at or after
+// start, e.g. within a trailing description
+func matchedFrom(matched []int, start int) bool {
+	for _, i := range matched {
+		if i >= start {
+			return true
+		}
+	}
+	return false
+}
+
+// searchFilters are the field-scoped terms of a search, lowercased. A
+// command must match all of them.
+type searchFilters struct {
+	tags  []string // #tag or tag:tag, matched as tag prefixes
+	names []string // name:text, matched as substrings, like cmds and descs
+	cmds  []string // cmd:text
+	descs []string // desc:text
+}
+
+func (f searchFilters) empty() bool {
+	return len(f.tags)+len(f.names)+len(f.cmds)+len(f.descs) == 0
+}
+
+// match reports whether c matches every filter
+func (f searchFilters) match(c model.Command) bool {
+	return hasTags(c, f.tags) &&
+		containsAll(c.Name, f.names) &&
+		containsAll(c.Cmd, f.cmds) &&
+		containsAll(c.Description, f.descs)
+}
+
+// parseSearch separates #tag and field:text terms from the fuzzy search
+// text. Words with any other prefix, like http://, stay in the text.
+func parseSearch(input string) (filters searchFilters, rest string) {
+	var words []string
+	for _, w := range strings.Fields(input) {
+		field, value, scoped := strings.Cut(w, ":")
+		value = strings.ToLower(value)
+		switch {
+		case len(w) > 1 && strings.HasPrefix(w, "#"):
+			filters.tags = append(filters.tags, strings.ToLower(w[1:]))
+		case !scoped:
+			words = append(words, w)
+		case value == "" && slices.Contains([]string{"tag", "name", "cmd", "desc"}, field):
+			// Still being typed
+		case field == "tag":
+			filters.tags = append(filters.tags, strings.TrimPrefix(value, "#"))
+		case field == "name":
+			filters.names = append(filters.names, value)
+		case field == "cmd":
+			filters.cmds = append(filters.cmds, value)
+		case field == "desc":
+			filters.descs = append(filters.descs, value)
+		default:
+			words = append(words, w)
+		}
+	}
+	return filters, strings.Join(words, " ")
+}
+
+// containsAll reports whether s contains each of the lowercase substrings,
+// ignoring case
+func containsAll(s string, subs []string) bool {
+	s = strings.ToLower(s)
+	for _, sub := range subs {
+		if !strings.Contains(s, sub) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasTags reports whether c has a tag starting with each prefix, so the
+// list narrows while a tag is still being typed
+func hasTags(c model.Command, prefixes []string) bool {
+	for _, p := range prefixes {
+		found := false
+		for _, t := range c.TagList() {
+			if strings.HasPrefix(t, p) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeTags lowercases, trims and de-duplicates a comma-separated tag list
+func normalizeTags(s string) string {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, t := range strings.Split(s, ",") {
+		t = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(t), "#"))
+		if t != "" && !seen[t] {
+			seen[t] = true
+			tags = append(tags, t)
+		}
+	}
+	return strings.Join(tags, ",")
+}
+
 func (a *App) filterQueries() {
 	query := a.searchInput.Value()
+	a.queryMatches = nil
 	if query == "" {
 		a.filteredQueries = a.queries
 		return
@@ -784,12 +2707,12 @@ func (a *App) filterQueries() {
 
 	var targets []string
 	for _, q := range a.queries {
-		targets = append(targets, q.Name+" "+q.SQL)
+		targets = append(targets, q.Name+" "+q.SQL+" "+q.Description)
 	}
 
-	matches := fuzzy.Find(query, targets)
-	a.filteredQueries = make([]model.Query, len(matches))
-	for i, m := range matches {
+	a.queryMatches = fuzzy.Find(query, targets)
+	a.filteredQueries = make([]model.Query, len(a.queryMatches))
+	for i, m := range a.queryMatches {
 		a.filteredQueries[i] = a.queries[m.Index]
 	}
 
@@ -798,11 +2721,31 @@ func (a *App) filterQueries() {
 	}
 }
 
+// The smallest terminal the layout fits in; View asks for more room below it
+const (
+	minWidth  = 60
+	minHeight = 20
+)
+
 func (a *App) View() string {
 	if a.width == 0 {
 		return "Loading..."
 	}
 
+	// The window size less the app padding, see the WindowSizeMsg handler
+	if w, h := a.width+4, a.height+2; w < minWidth || h < minHeight {
+		msg := warningStyle.Render("Terminal too small") + "\n" +
+			mutedStyle.Render(fmt.Sprintf("%dx%d, cmdbox needs at least %dx%d", w, h, minWidth, minHeight))
+		return lipgloss.Place(w, h, lipgloss.Center, lipgloss.Center, msg)
+	}
+
+	if a.mode == modeHelp {
+		return appStyle.Render(a.renderHelpModal())
+	}
+	if a.mode == modeView {
+		return appStyle.Render(a.renderViewer())
+	}
+
 	var b strings.Builder
 
 	// Title with tabs
@@ -810,6 +2753,9 @@ func (a *App) View() string {
 	b.WriteString(title)
 	b.WriteString("  ")
 	b.WriteString(a.renderTabs())
+	if a.tab == tabBash {
+		b.WriteString("  " + mutedStyle.Render("sort: "+a.order.String()))
+	}
 	b.WriteString("\n\n")
 
 	// Search bar
@@ -818,13 +2764,23 @@ func (a *App) View() string {
 	b.WriteString("\n\n")
 
 	// List
-	listHeight := a.height - a.output.Height - 10
-	if listHeight < 3 {
-		listHeight = 3
-	}
+	listHeight := a.listHeight()
 
 	if a.mode == modeAdd || a.mode == modeEdit {
 		b.WriteString(a.renderForm())
+	} else if a.showSidebar() || a.detailWidth() > 0 {
+		// List items take two lines each
+		var panes []string
+		if a.showSidebar() {
+			panes = append(panes, a.renderSidebar(listHeight), " ")
+		}
+		list := strings.TrimSuffix(a.renderList(listHeight), "\n")
+		panes = append(panes, lipgloss.NewStyle().Width(a.listWidth()).MaxWidth(a.listWidth()).Render(list))
+		if a.detailWidth() > 0 {
+			panes = append(panes, " ", a.renderDetail(listHeight*2))
+		}
+		b.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, panes...))
+		b.WriteString("\n")
 	} else {
 		b.WriteString(a.renderList(listHeight))
 	}
@@ -842,23 +2798,101 @@ func (a *App) View() string {
 		b.WriteString("\n")
 	}
 
-	// Param input (inline)
+	// Confirmation before a query that may change data
+	if a.mode == modeConfirmQuery {
+		q := a.pendingQuery
+		b.WriteString("\n")
+		b.WriteString(warningStyle.Render(fmt.Sprintf("Run %s query '%s'? (y/n)", writeKinds(q.SQL), q.Name)))
+		b.WriteString("\n")
+	}
+
+	// A batch command failed; ask whether to run the rest
+	if a.mode == modeConfirmBatch {
+		b.WriteString("\n")
+		b.WriteString(warningStyle.Render(fmt.Sprintf("'%s' failed. Run the remaining %d? (y/n)", a.outputName, len(a.batch))))
+		b.WriteString("\n")
+	}
+
+	// Param input, inline or one per line
 	if a.mode == modeParam {
+		if desc := a.paramDescription(); desc != "" {
+			b.WriteString("\n")
+			b.WriteString(mutedStyle.Render(desc))
+		}
+	}
+	if a.mode == modeParam && a.paramFieldMode {
+		b.WriteString("\n")
+		b.WriteString(labelStyle.Render("Params:"))
+		if note := a.runNote(); note != "" {
+			b.WriteString(" " + mutedStyle.Render(note))
+		}
+		b.WriteString("\n")
+		nameWidth := 0
+		for _, p := range a.paramInfos {
+			nameWidth = max(nameWidth, len(p.Name))
+		}
+		for i, p := range a.paramInfos {
+			lock := "   "
+			if p.Sensitive {
+				lock = lockIcon + " "
+			}
+			b.WriteString(lock + labelStyle.Render(fmt.Sprintf("%-*s ", nameWidth+1, p.Name+":")))
+			b.WriteString(a.paramFields[i].View())
+			b.WriteString("\n")
+		}
+		if note := a.sensitiveNote(); note != "" {
+			b.WriteString("   " + note + "\n")
+		}
+		b.WriteString(helpStyle.Render("  (tab between params, ↑/↓ for recent values, enter to run, ctrl+d to preview, ctrl+t for inline, esc to cancel)"))
+		b.WriteString("\n")
+	} else if a.mode == modeParam {
 		b.WriteString("\n")
 		b.WriteString(labelStyle.Render("Params: "))
+		if note := a.runNote(); note != "" {
+			b.WriteString(mutedStyle.Render(note + " "))
+		}
 		b.WriteString(a.paramInput.View())
 		b.WriteString("\n")
-		b.WriteString(helpStyle.Render("  (edit values inline, enter to run, esc to cancel)"))
+		var names []string
+		for _, p := range a.paramInfos {
+			if p.Sensitive {
+				names = append(names, lockIcon+" "+p.Name)
+			} else {
+				names = append(names, p.Name)
+			}
+		}
+		b.WriteString("  " + mutedStyle.Render(strings.Join(names, "  ")))
+		if note := a.sensitiveNote(); note != "" {
+			b.WriteString("  " + note)
+		}
+		b.WriteString("\n")
+		b.WriteString(helpStyle.Render("  (edit values inline, ↑/↓ for recent values, enter to run, ctrl+d to preview, ctrl+t for one per line, esc to cancel)"))
 		b.WriteString("\n")
 	}
 
 	// Output pane
 	b.WriteString("\n")
 	outputTitle := outputTitleStyle.Render("OUTPUT")
+	if a.running {
+		outputTitle += "  " + warningStyle.Render("running "+formatElapsed(time.Since(a.runStarted)))
+	}
+	if a.appendRuns {
+		outputTitle += "  " + mutedStyle.Render("appending runs")
+	}
+	if a.batchTotal > 0 {
+		outputTitle += "  " + mutedStyle.Render(fmt.Sprintf("batch %d/%d", a.batchTotal-len(a.batch), a.batchTotal))
+	}
+	if a.droppedLines > 0 {
+		outputTitle += mutedStyle.Render(fmt.Sprintf("  last %d lines, %d older dropped", len(a.outputLines), a.droppedLines))
+	}
 	b.WriteString(outputTitle)
 	b.WriteString("\n")
 
-	outputBox := borderStyle.Width(a.width - 4).Render(a.output.View())
+	outputBorder := borderStyle.Width(a.width - 4)
+	if a.outputFocus {
+		outputBorder = outputBorder.BorderForeground(primary)
+	}
+	outputBox := outputBorder.Render(a.output.View())
 	b.WriteString(outputBox)
 	b.WriteString("\n")
 
@@ -871,18 +2905,126 @@ func (a *App) View() string {
 		b.WriteString(successStyle.Render(a.status))
 		b.WriteString("\n")
 	}
+	if a.info != "" {
+		b.WriteString(mutedStyle.Render(a.info))
+		b.WriteString("\n")
+	}
 
 	// Help bar
 	b.WriteString(a.renderHelp())
 
+	if bar := a.renderStatusBar(); bar != "" {
+		b.WriteString("\n")
+		b.WriteString(bar)
+	}
+
 	return appStyle.Render(b.String())
 }
 
+// minStatusBarWidth is the narrowest terminal that gets a status bar
+const minStatusBarWidth = 60
+
+// renderStatusBar counts what each tab holds and how many of them the
+// search leaves shown, e.g. "Bash: 42 commands (12 shown) · SQL: 9 queries"
+func (a *App) renderStatusBar() string {
+	if a.width < minStatusBarWidth {
+		return ""
+	}
+
+	count := func(label string, total, shown int, noun string) string {
+		s := fmt.Sprintf("%s: %d %s", label, total, noun)
+		if shown < total {
+			s += fmt.Sprintf(" (%d shown)", shown)
+		}
+		return s
+	}
+	commands := "commands"
+	if a.showArchived {
+		commands = "archived"
+	}
+	bash := count("Bash", len(a.commands), len(a.filtered)-a.pinned, commands)
+	if a.paramFilter != paramFilterOff {
+		bash += ", " + a.paramFilter.String()
+	}
+	if len(a.marked) > 0 {
+		bash += fmt.Sprintf(", %d marked", len(a.marked))
+	}
+	return mutedStyle.Render(strings.Join([]string{
+		bash,
+		count("SQL", len(a.queries), len(a.filteredQueries), "queries"),
+		count("History", len(a.history), len(a.filteredHistory), "runs"),
+	}, " · "))
+}
+
 func (a *App) renderList(height int) string {
-	if a.tab == tabBash {
+	switch a.tab {
+	case tabBash:
 		return a.renderCommandList(height)
+	case tabSQL:
+		return a.renderQueryList(height)
+	default:
+		return a.renderHistoryList(height)
+	}
+}
+
+// listHeight is how many list items fit above the output pane
+func (a *App) listHeight() int {
+	h := a.height - a.output.Height - 10
+	if a.width >= minStatusBarWidth {
+		h-- // status bar
+	}
+	return max(h, 3)
+}
+
+// listWidth is the width left for the list beside the category sidebar
+// and detail pane
+func (a *App) listWidth() int {
+	w := a.width
+	if a.showSidebar() {
+		w -= sidebarWidth + 1
+	}
+	if d := a.detailWidth(); d > 0 {
+		w -= d + 1
+	}
+	return w
+}
+
+// visibleItems is how many items of the current tab's list are drawn,
+// less the line renderCommandList keeps for the recent heading
+func (a *App) visibleItems() int {
+	h := a.listHeight()
+	if a.tab == tabBash && a.pinned > 0 {
+		h--
+	}
+	return h
+}
+
+// scrollToCursor moves the list's offset just enough to keep the cursor
+// in view, and no further than the end of the list
+func (a *App) scrollToCursor() {
+	height := a.visibleItems()
+	if a.cursor < a.offset {
+		a.offset = a.cursor
+	}
+	if a.cursor >= a.offset+height {
+		a.offset = a.cursor - height + 1
+	}
+	a.offset = max(min(a.offset, a.listLen()-height), 0)
+}
+
+// visibleRange returns the window of n items to draw, from the offset
+// kept by scrollToCursor
+func (a *App) visibleRange(height, n int) (start, end int) {
+	start = max(min(a.offset, n-height), 0)
+	return start, min(start+height, n)
+}
+
+// renderPosition shows "12/240" under a list that doesn't fit on screen
+func (a *App) renderPosition(height, n int) string {
+	if n <= height {
+		return ""
 	}
-	return a.renderQueryList(height)
+	return mutedStyle.Render(fmt.Sprintf("  %d/%d", a.cursor+1, n)) + "\n"
 }
 
 func (a *App) renderCommandList(height int) string {
@@ -890,18 +3032,21 @@ func (a *App) renderCommandList(height int) string {
 		return mutedStyle.Render("No commands found. Press 'A' to add one.\n")
 	}
 
-	var lines []string
-	start := 0
-	if a.cursor >= height {
-		start = a.cursor - height + 1
-	}
+	width := a.listWidth() - 10
 
-	end := start + height
-	if end > len(a.filtered) {
-		end = len(a.filtered)
+	var lines []string
+	if a.pinned > 0 {
+		height-- // room for the recent heading and separator
 	}
+	start, end := a.visibleRange(height, len(a.filtered))
 
 	for i := start; i < end; i++ {
+		switch {
+		case i == 0 && a.pinned > 0:
+			lines = append(lines, mutedStyle.Render("  Recently used"))
+		case i == a.pinned && a.pinned > 0:
+			lines = append(lines, mutedStyle.Render("  "+strings.Repeat("─", max(width, 1))))
+		}
 		cmd := a.filtered[i]
 		prefix := "  "
 		style := normalStyle
@@ -910,12 +3055,34 @@ func (a *App) renderCommandList(height int) string {
 			style = selectedStyle
 		}
 
-		name := style.Render(prefix + cmd.Name)
-		preview := cmdPreviewStyle.Render("  " + truncate(cmd.Cmd, a.width-10))
+		// The search target is "name cmd description"
+		var matched []int
+		if a.matches != nil {
+			matched = a.matches[i].MatchedIndexes
+		}
+		cmdStart := len(cmd.Name) + 1
+		descStart := cmdStart + len(cmd.Cmd) + 1
+
+		if a.marked[cmd.ID] {
+			prefix += "✓ "
+		}
+		if cmd.Locked {
+			prefix += lockIcon + " "
+		}
+		name := style.Render(prefix) + renderLabel(cmd.Label) + highlightMatches(cmd.Name, matched, 0, style) + renderTags(cmd.TagList())
+		// Last used at the right edge, when there's room for it
+		if used := humanizeTime(cmd.LastUsedAt); lipgloss.Width(name)+2+len(used) <= width+2 {
+			name += strings.Repeat(" ", width+2-lipgloss.Width(name)-len(used)) + mutedStyle.Render(used)
+		}
+		preview := cmdPreviewStyle.Render("  ") + highlightMatches(truncate(strings.Split(cmd.Cmd, "\n")[0], width), matched, cmdStart, cmdPreviewStyle)
+		if matchedFrom(matched, descStart) {
+			preview = cmdPreviewStyle.Render("  description: ") +
+				highlightMatches(truncate(cmd.Description, width-13), matched, descStart, cmdPreviewStyle)
+		}
 		lines = append(lines, name, preview)
 	}
 
-	return strings.Join(lines, "\n") + "\n"
+	return strings.Join(lines, "\n") + "\n" + a.renderPosition(height, len(a.filtered))
 }
 
 func (a *App) renderQueryList(height int) string {
@@ -924,15 +3091,7 @@ func (a *App) renderQueryList(height int) string {
 	}
 
 	var lines []string
-	start := 0
-	if a.cursor >= height {
-		start = a.cursor - height + 1
-	}
-
-	end := start + height
-	if end > len(a.filteredQueries) {
-		end = len(a.filteredQueries)
-	}
+	start, end := a.visibleRange(height, len(a.filteredQueries))
 
 	for i := start; i < end; i++ {
 		q := a.filteredQueries[i]
@@ -943,14 +3102,59 @@ func (a *App) renderQueryList(height int) string {
 			style = selectedStyle
 		}
 
-		name := style.Render(prefix + q.Name)
+		// The search target is "name sql description"
+		var matched []int
+		if a.queryMatches != nil {
+			matched = a.queryMatches[i].MatchedIndexes
+		}
+		descStart := len(q.Name) + len(q.SQL) + 2
+
+		name := style.Render(prefix) + highlightMatches(q.Name, matched, 0, style)
 		// Show first line of SQL as preview
 		firstLine := strings.Split(q.SQL, "\n")[0]
-		preview := cmdPreviewStyle.Render("  " + truncate(firstLine, a.width-10))
+		preview := "  " + highlightSQL(truncate(firstLine, a.width-10))
+		if matchedFrom(matched, descStart) {
+			preview = cmdPreviewStyle.Render("  description: ") +
+				highlightMatches(truncate(q.Description, a.width-23), matched, descStart, cmdPreviewStyle)
+		}
 		lines = append(lines, name, preview)
 	}
 
-	return strings.Join(lines, "\n") + "\n"
+	return strings.Join(lines, "\n") + "\n" + a.renderPosition(height, len(a.filteredQueries))
+}
+
+func (a *App) renderHistoryList(height int) string {
+	if len(a.filteredHistory) == 0 {
+		return mutedStyle.Render("No history yet. Run a command from the Bash tab.\n")
+	}
+
+	var lines []string
+	start, end := a.visibleRange(height, len(a.filteredHistory))
+
+	for i := start; i < end; i++ {
+		h := a.filteredHistory[i]
+		prefix := "  "
+		style := normalStyle
+		if i == a.cursor {
+			prefix = "▸ "
+			style = selectedStyle
+		}
+
+		name := h.CommandName
+		if name == "" {
+			name = "(deleted command)"
+		}
+		status := successStyle.Render("✔")
+		if h.ExitCode != 0 {
+			status = errorStyle.Render(fmt.Sprintf("✘ %d", h.ExitCode))
+		}
+		title := style.Render(prefix+name) + " " + status + " " +
+			mutedStyle.Render(h.RanAt.Local().Format("2006-01-02 15:04"))
+		preview := cmdPreviewStyle.Render("  " + truncate(strings.Split(h.FinalCmd, "\n")[0], a.width-10))
+		lines = append(lines, title, preview)
+	}
+
+	return strings.Join(lines, "\n") + "\n" + a.renderPosition(height, len(a.filteredHistory))
 }
 
 func (a *App) renderForm() string {
@@ -970,23 +3174,105 @@ func (a *App) renderBashForm() string {
 	b.WriteString(labelStyle.Render(title))
 	b.WriteString("\n\n")
 
-	labels := []string{"Name", "Command", "Description"}
-	for i, input := range a.formInputs {
+	if a.reviewingEdit {
+		b.WriteString("Changes to the command:\n\n")
+		b.WriteString(renderDiff(a.editingCmd.Cmd, strings.TrimSpace(a.cmdTextarea.Value())))
+		b.WriteString("\n")
+		b.WriteString(helpStyle.Render("S: save • esc: back to editing"))
+		b.WriteString("\n")
+		return b.String()
+	}
+
+	// Name field (formFocus 0)
+	b.WriteString(labelStyle.Render("Name: "))
+	style := inputStyle
+	if a.formFocus == 0 {
+		style = focusedInputStyle
+	}
+	b.WriteString(style.Width(a.width - 20).Render(a.formInputs[0].View()))
+	b.WriteString("\n\n")
+
+	// Command textarea (formFocus 1)
+	b.WriteString(labelStyle.Render("Command: "))
+	b.WriteString("\n")
+	cmdStyle := inputStyle
+	if a.formFocus == 1 {
+		cmdStyle = focusedInputStyle
+	}
+	b.WriteString(cmdStyle.Width(a.width - 10).Render(a.cmdTextarea.View()))
+	b.WriteString("\n")
+	if hint := a.formParamsHint(); hint != "" {
+		b.WriteString(mutedStyle.Render(ansi.Truncate(hint, a.width-6, "…")))
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+
+	// The rest of the inputs sit one focus position after their index
+	labels := []string{"Description", "Tags", "Category", "Timeout", "Shell", "Directory", "Label"}
+	for i, input := range a.formInputs[1:] {
 		b.WriteString(labelStyle.Render(labels[i] + ": "))
 		style := inputStyle
-		if i == a.formFocus {
+		if i+2 == a.formFocus {
 			style = focusedInputStyle
 		}
 		b.WriteString(style.Width(a.width - 20).Render(input.View()))
+		if i+1 == labelInputIndex {
+			b.WriteString(" " + renderLabel(normalizeLabel(input.Value())))
+		}
 		b.WriteString("\n\n")
 	}
 
-	b.WriteString(helpStyle.Render("down: next field • enter: save • esc: cancel"))
+	// Env textarea (after the inputs)
+	b.WriteString(labelStyle.Render("Environment: "))
+	b.WriteString("\n")
+	envStyle := inputStyle
+	if a.formFocus == len(a.formInputs)+1 {
+		envStyle = focusedInputStyle
+	}
+	b.WriteString(envStyle.Width(a.width - 10).Render(a.envTextarea.View()))
+	b.WriteString("\n\n")
+
+	interactive := "no, output shows below the list"
+	if a.formInteractive {
+		interactive = "yes, runs in the terminal (a new window in tmux)"
+	}
+	b.WriteString(labelStyle.Render("Interactive: ") + interactive + mutedStyle.Render("  ctrl+t to toggle"))
+	b.WriteString("\n\n")
+
+	b.WriteString(helpStyle.Render("down: next field • enter: save, or newline in text areas • ctrl+o: edit command in $EDITOR • S: save • esc: cancel"))
 	b.WriteString("\n")
 
 	return b.String()
 }
 
+// formParamsHint lists the params found in the command being edited, so
+// it's clear as you type that the {{...}} syntax was recognized
+func (a *App) formParamsHint() string {
+	params := runner.CommandParams(model.Command{Cmd: a.cmdTextarea.Value(), Env: a.envTextarea.Value()})
+	if len(params) == 0 {
+		return ""
+	}
+	parts := make([]string, len(params))
+	for i, p := range params {
+		s := p.Name
+		if p.Sensitive {
+			s = lockIcon + " " + s
+		}
+		switch {
+		case p.EnvVar != "" && p.Default != "":
+			s += " from $" + p.EnvVar + ", else " + p.Default
+		case p.EnvVar != "":
+			s += " from $" + p.EnvVar
+		case p.Default != "":
+			s += " = " + p.Default
+		default:
+			s += " (required)"
+		}
+		parts[i] = s
+	}
+	return "Params: " + strings.Join(parts, " · ")
+}
+
 func (a *App) renderSQLForm() string {
 	var b strings.Builder
 
@@ -1025,25 +3311,37 @@ func (a *App) renderSQLForm() string {
 	b.WriteString(style.Width(a.width - 20).Render(a.formInputs[1].View()))
 	b.WriteString("\n\n")
 
-	b.WriteString(helpStyle.Render("down: next field • S: save • esc: cancel"))
+	// Connection field (formFocus 3)
+	b.WriteString(labelStyle.Render("Connection: "))
+	style = inputStyle
+	if a.formFocus == 3 {
+		style = focusedInputStyle
+	}
+	b.WriteString(style.Width(a.width - 20).Render(a.formInputs[2].View()))
+	b.WriteString("\n\n")
+
+	b.WriteString(helpStyle.Render("down: next field • ctrl+o: edit SQL in $EDITOR • S: save • esc: cancel"))
 	b.WriteString("\n")
 
 	return b.String()
 }
 
 func (a *App) renderTabs() string {
-	bashTab := "Bash"
-	sqlTab := "SQL"
+	names := []string{"Bash", "SQL", "History"}
+	if a.showArchived {
+		names[tabBash] = "Bash: archived"
+	}
 
-	if a.tab == tabBash {
-		bashTab = selectedStyle.Render("[Bash]")
-		sqlTab = mutedStyle.Render(" SQL ")
-	} else {
-		bashTab = mutedStyle.Render(" Bash ")
-		sqlTab = selectedStyle.Render("[SQL]")
+	var tabs []string
+	for i, name := range names {
+		if tab(i) == a.tab {
+			tabs = append(tabs, selectedStyle.Render("["+name+"]"))
+		} else {
+			tabs = append(tabs, mutedStyle.Render(" "+name+" "))
+		}
 	}
 
-	return bashTab + " " + sqlTab + "  " + helpStyle.Render("(tab to switch)")
+	return strings.Join(tabs, " ") + "  " + helpStyle.Render("(tab to switch)")
 }
 
 func (a *App) renderHelp() string {
@@ -1051,32 +3349,78 @@ func (a *App) renderHelp() string {
 		return ""
 	}
 
+	k := a.keys
 	var parts []string
-	if a.tab == tabBash {
+	if a.sidebarFocus {
+		parts = []string{
+			helpKey("up/down", "pick category"),
+			helpKey("L", "back to list"),
+			helpKey(k.Quit, "quit"),
+		}
+	} else if a.outputFocus {
+		parts = []string{
+			helpKey("j/k/h/l", "scroll"),
+			helpKey("g/G", "top/bottom"),
+			helpKey("ctrl+o", "back to list"),
+			helpKey(k.Quit, "quit"),
+		}
+	} else if a.tab != tabSQL && a.running {
+		parts = []string{
+			helpKey("ctrl+x", "stop"),
+			helpKey("C", "clear"),
+			helpKey("?", "help"),
+			helpKey(k.Quit, "quit"),
+		}
+	} else if a.tab == tabHistory {
 		parts = []string{
-			helpKeyStyle.Render("enter") + " " + helpStyle.Render("run"),
-			helpKeyStyle.Render("A") + helpStyle.Render("dd"),
-			helpKeyStyle.Render("E") + helpStyle.Render("dit"),
-			helpKeyStyle.Render("D") + helpStyle.Render("elete"),
-			helpKeyStyle.Render("Y") + helpStyle.Render("ank"),
-			helpKeyStyle.Render("C") + helpStyle.Render("lear"),
-			helpKeyStyle.Render("Q") + helpStyle.Render("uit"),
+			helpKey(k.Run, "rerun"),
+			helpKey(k.Yank, "yank"),
+			helpKey("C", "clear"),
+			helpKey("?", "help"),
+			helpKey(k.Quit, "quit"),
 		}
 	} else {
 		parts = []string{
-			helpKeyStyle.Render("enter") + " " + helpStyle.Render("view"),
-			helpKeyStyle.Render("A") + helpStyle.Render("dd"),
-			helpKeyStyle.Render("E") + helpStyle.Render("dit"),
-			helpKeyStyle.Render("D") + helpStyle.Render("elete"),
-			helpKeyStyle.Render("Y") + helpStyle.Render("ank"),
-			helpKeyStyle.Render("C") + helpStyle.Render("lear"),
-			helpKeyStyle.Render("Q") + helpStyle.Render("uit"),
+			helpKey(k.Run, "run"),
+			helpKey(k.Add, "add"),
+			helpKey(k.Edit, "edit"),
+			helpKey(k.Delete, "delete"),
+			helpKey(k.Yank, "yank"),
+			helpKey("C", "clear"),
+			helpKey("X", "export"),
+			helpKey("?", "help"),
+			helpKey(k.Quit, "quit"),
 		}
 	}
+	if a.tab == tabSQL && len(a.queryRows) > 0 {
+		parts = slices.Insert(parts, len(parts)-2, helpKey("R", "csv"))
+	}
 
 	return strings.Join(parts, "  ")
 }
 
+// helpKey renders a help bar entry. A key that is the label's first letter
+// is folded into it, so ("A", "add") renders as "Add".
+func helpKey(key, label string) string {
+	if len(key) == 1 && strings.HasPrefix(label, strings.ToLower(key)) {
+		return helpKeyStyle.Render(key) + helpStyle.Render(label[1:])
+	}
+	return helpKeyStyle.Render(key) + " " + helpStyle.Render(label)
+}
+
+// renderTags renders tags as colored chips, each tag keeping its color
+func renderTags(tags []string) string {
+	var b strings.Builder
+	for _, t := range tags {
+		h := fnv.New32a()
+		h.Write([]byte(t))
+		color := tagColors[h.Sum32()%uint32(len(tagColors))]
+		b.WriteString(" ")
+		b.WriteString(tagStyle.Background(color).Render(t))
+	}
+	return b.String()
+}
+
 func truncate(s string, max int) string {
 	if len(s) <= max {
 		return s
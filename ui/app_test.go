@@ -0,0 +1,357 @@
+package ui
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+	"testing"
+
+	"cmdbox/config"
+	"cmdbox/db"
+	"cmdbox/model"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// newTestApp returns an App on a fresh in-memory database, with HOME
+// pointed at a temporary directory so nothing real is read or written
+func newTestApp(t *testing.T) (*App, *db.DB) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	d, err := db.NewWithPath(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	a, err := NewApp(d, config.Default(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Update(tea.WindowSizeMsg{Width: 120, Height: 40})
+	return a, d
+}
+
+// addCommand saves a command and reloads the list
+func addCommand(t *testing.T, a *App, d *db.DB, name, cmd string) {
+	t.Helper()
+	if _, err := d.Add(model.Command{Name: name, Cmd: cmd}); err != nil {
+		t.Fatal(err)
+	}
+	a.refreshCommands()
+}
+
+// selectCommand moves the cursor to the command named name
+func selectCommand(t *testing.T, a *App, name string) {
+	t.Helper()
+	for i, c := range a.filtered {
+		if c.Name == name {
+			a.cursor = i
+			return
+		}
+	}
+	t.Fatalf("no command %q in the list", name)
+}
+
+// finishRun feeds the running command's output to the App until it's done
+func finishRun(a *App) {
+	for a.running {
+		a.Update(waitForOutput(a.outputChan)())
+	}
+}
+
+// getCommand loads the command named name from the database
+func getCommand(t *testing.T, d *db.DB, name string) *model.Command {
+	t.Helper()
+	c, err := d.GetByName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func key(k tea.KeyType) tea.KeyMsg {
+	return tea.KeyMsg{Type: k}
+}
+
+func TestParseInlineParams(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  map[string]string
+	}{
+		{"empty", "", map[string]string{}},
+		{"plain", "a=1 b=two", map[string]string{"a": "1", "b": "two"}},
+		{"extra spaces", "  a=1 \t b=2  ", map[string]string{"a": "1", "b": "2"}},
+		{"empty value", "a= b=2", map[string]string{"a": "", "b": "2"}},
+		{"double quoted spaces", `msg="hello world" n=1`, map[string]string{"msg": "hello world", "n": "1"}},
+		{"single quoted spaces", `msg='hello world' n=1`, map[string]string{"msg": "hello world", "n": "1"}},
+		{"quoted empty", `msg="" n=1`, map[string]string{"msg": "", "n": "1"}},
+		{"equals in value", "q=a=b", map[string]string{"q": "a=b"}},
+		{"quoted equals", `q="a = b"`, map[string]string{"q": "a = b"}},
+		{"escaped double quote", `msg="say \"hi\""`, map[string]string{"msg": `say "hi"`}},
+		{"escaped backslash", `path="C:\\dir"`, map[string]string{"path": `C:\dir`}},
+		{"other backslash kept", `re="a\d+"`, map[string]string{"re": `a\d+`}},
+		{"single quotes keep backslashes", `re='a\"b'`, map[string]string{"re": `a\"b`}},
+		{"other quote inside", `msg="it's" q='say "hi"'`, map[string]string{"msg": "it's", "q": `say "hi"`}},
+		{"quote mid value", `msg=hello" big "world`, map[string]string{"msg": "hello big world"}},
+		{"unterminated double quote", `a=1 msg="hello world b=2`, map[string]string{"a": "1", "msg": "hello world b=2"}},
+		{"unterminated single quote", `msg='hello`, map[string]string{"msg": "hello"}},
+		{"word without equals", "a=1 stray b=2", map[string]string{"a": "1", "b": "2"}},
+		{"no key", "=1 a=2", map[string]string{"a": "2"}},
+		{"repeated key", "a=1 a=2", map[string]string{"a": "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseInlineParams(tt.input)
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("parseInlineParams(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuoteInlineValueRoundTrip(t *testing.T) {
+	for _, v := range []string{"", "plain", "hello world", `say "hi"`, "it's", `C:\dir`, `a\"b`, "tab\there"} {
+		got := parseInlineParams("v=" + quoteInlineValue(v))["v"]
+		if got != v {
+			t.Errorf("quoteInlineValue(%q) read back as %q", v, got)
+		}
+	}
+}
+
+// TestRunKeepsParamsOfEarlierParamSet checks a run with nothing to save,
+// here only a sensitive param, leaves the values remembered from when the
+// command had other params alone
+func TestRunKeepsParamsOfEarlierParamSet(t *testing.T) {
+	a, d := newTestApp(t)
+	addCommand(t, a, d, "deploy", "true {{env}}")
+
+	selectCommand(t, a, "deploy")
+	a.runSelectedCommand(false)
+	a.paramInput.SetValue("env=prod")
+	a.Update(key(tea.KeyEnter))
+	finishRun(a)
+
+	c := getCommand(t, d, "deploy")
+	c.Cmd = "true {{!token}}"
+	if err := d.Update(*c); err != nil {
+		t.Fatal(err)
+	}
+	a.refreshCommands()
+
+	selectCommand(t, a, "deploy")
+	a.runSelectedCommand(false)
+	if a.mode != modeParam || !a.paramFieldMode {
+		t.Fatal("expected the param fields to be asked for")
+	}
+	a.paramFields[0].SetValue("hunter2")
+	a.Update(key(tea.KeyEnter))
+	finishRun(a)
+
+	c = getCommand(t, d, "deploy")
+	if c.LastParams != `{"env":"prod"}` {
+		t.Errorf("LastParams = %s, want the earlier env value kept", c.LastParams)
+	}
+	history, err := d.ParamHistory(c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := history["env"]; len(got) != 1 || got[0] != "prod" {
+		t.Errorf("env history = %q, want [prod]", got)
+	}
+	if _, ok := history["token"]; ok {
+		t.Error("sensitive value was added to the param history")
+	}
+}
+
+// TestSensitiveValueNotInOutput checks a {{!token}} value is masked in the
+// command echoed to the output pane, in the ctrl+d preview and in history
+func TestSensitiveValueNotInOutput(t *testing.T) {
+	const secret = "s3cret-token-value"
+	a, d := newTestApp(t)
+	addCommand(t, a, d, "login", "true --user {{user}} --token {{!token}}")
+
+	selectCommand(t, a, "login")
+	a.runSelectedCommand(false)
+	if a.mode != modeParam || !a.paramFieldMode {
+		t.Fatal("expected the param fields to be asked for")
+	}
+	a.paramFields[0].SetValue("bob")
+	a.paramFields[1].SetValue(secret)
+
+	a.Update(tea.KeyMsg{Type: tea.KeyCtrlD})
+	checkNoSecret(t, "preview", a.outputLines, secret)
+
+	a.Update(key(tea.KeyEnter))
+	finishRun(a)
+	checkNoSecret(t, "output", a.outputLines, secret)
+	if out := ansi.Strip(strings.Join(a.outputLines, "\n")); !strings.Contains(out, "--token '****'") {
+		t.Errorf("output doesn't echo the masked command:\n%s", out)
+	}
+
+	history, err := d.ListHistory(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("got %d history entries, want 1", len(history))
+	}
+	checkNoSecret(t, "history", []string{history[0].FinalCmd}, secret)
+	checkNoSecret(t, "saved params", []string{getCommand(t, d, "login").LastParams}, secret)
+}
+
+// TestRerunRedactedHistoryOfDeletedCommand checks a run with masked values
+// can't be rerun from history once its command is gone, since the masked
+// values would run as a literal ****
+func TestRerunRedactedHistoryOfDeletedCommand(t *testing.T) {
+	a, d := newTestApp(t)
+	addCommand(t, a, d, "login", "true --token {{!token}}")
+
+	selectCommand(t, a, "login")
+	a.runSelectedCommand(false)
+	a.paramFields[0].SetValue("s3cret")
+	a.Update(key(tea.KeyEnter))
+	finishRun(a)
+
+	if err := d.Delete(getCommand(t, d, "login").ID); err != nil {
+		t.Fatal(err)
+	}
+	a.refreshCommands()
+	a.refreshHistory()
+	if len(a.filteredHistory) != 1 || !a.filteredHistory[0].Redacted {
+		t.Fatalf("history = %+v, want one redacted run", a.filteredHistory)
+	}
+
+	a.cursor = 0
+	a.err = ""
+	a.rerunHistory()
+	if a.running {
+		finishRun(a)
+		t.Fatal("the redacted run was started again")
+	}
+	if a.err == "" {
+		t.Error("no error shown for the redacted run")
+	}
+}
+
+// TestDryRunLeavesOutComments checks the ctrl+d preview shows the command
+// as it would run, without its comment lines
+func TestDryRunLeavesOutComments(t *testing.T) {
+	a, d := newTestApp(t)
+	addCommand(t, a, d, "greet", "# says hello\necho {{name}}")
+
+	selectCommand(t, a, "greet")
+	a.runSelectedCommand(false)
+	a.paramInput.SetValue("name=al")
+	a.Update(tea.KeyMsg{Type: tea.KeyCtrlD})
+
+	out := ansi.Strip(strings.Join(a.outputLines, "\n"))
+	if strings.Contains(out, "says hello") {
+		t.Errorf("dry run shows the comment:\n%s", out)
+	}
+	if !strings.Contains(out, "$ echo al") {
+		t.Errorf("dry run doesn't show the command:\n%s", out)
+	}
+}
+
+// TestCopyRefusesRefs checks ctrl+y won't copy a command whose {{@name}}
+// references would be left for the shell to choke on
+func TestCopyRefusesRefs(t *testing.T) {
+	a, d := newTestApp(t)
+	addCommand(t, a, d, "host", "echo db.local")
+	addCommand(t, a, d, "connect", "ssh {{@host}}")
+
+	selectCommand(t, a, "connect")
+	a.Update(tea.KeyMsg{Type: tea.KeyCtrlY})
+	if !strings.Contains(a.err, "references") || a.copyRun || a.mode != modeNormal {
+		t.Errorf("copy went ahead: err %q, copyRun %v, mode %v", a.err, a.copyRun, a.mode)
+	}
+}
+
+func checkNoSecret(t *testing.T, where string, lines []string, secret string) {
+	t.Helper()
+	for _, l := range lines {
+		if strings.Contains(ansi.Strip(l), secret) {
+			t.Errorf("%s shows the sensitive value: %q", where, l)
+		}
+	}
+}
+
+// TestParamsDontCarryOver checks a command without params, run after one
+// with params was run or cancelled, doesn't pick up the other's values
+func TestParamsDontCarryOver(t *testing.T) {
+	for _, cancel := range []bool{true, false} {
+		a, d := newTestApp(t)
+		addCommand(t, a, d, "greet", "true {{name}}")
+		addCommand(t, a, d, "plain", "true plain")
+
+		selectCommand(t, a, "greet")
+		a.runSelectedCommand(false)
+		a.paramInput.SetValue("name=al")
+		if cancel {
+			a.Update(key(tea.KeyEsc))
+		} else {
+			a.Update(key(tea.KeyEnter))
+			finishRun(a)
+		}
+
+		selectCommand(t, a, "plain")
+		a.runSelectedCommand(false)
+		finishRun(a)
+
+		if a.lastRun == nil || a.lastRun.Name != "plain" {
+			t.Fatalf("cancel=%v: last run is %v, want plain", cancel, a.lastRun)
+		}
+		plain := getCommand(t, d, "plain")
+		if plain.LastParams != "" {
+			t.Errorf("cancel=%v: plain saved params %s", cancel, plain.LastParams)
+		}
+		if history, _ := d.ParamHistory(plain.ID); len(history) > 0 {
+			t.Errorf("cancel=%v: plain has param history %v", cancel, history)
+		}
+		history, err := d.ListHistory(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != 1 || history[0].CommandID != plain.ID || history[0].FinalCmd != "true plain" {
+			t.Errorf("cancel=%v: last history entry is %+v, want plain's run", cancel, history)
+		}
+	}
+}
+
+// TestScrollKeepsCursorInView checks the list scrolls with the cursor as
+// it moves and the terminal shrinks, and that drawing it doesn't
+func TestScrollKeepsCursorInView(t *testing.T) {
+	a, d := newTestApp(t)
+	for i := range 40 {
+		addCommand(t, a, d, fmt.Sprintf("cmd%02d", i), "true")
+	}
+
+	inView := func(when string) {
+		t.Helper()
+		if a.cursor < a.offset || a.cursor >= a.offset+a.visibleItems() {
+			t.Errorf("%s: cursor %d outside rows %d-%d", when, a.cursor, a.offset, a.offset+a.visibleItems()-1)
+		}
+	}
+
+	a.Update(key(tea.KeyEnd))
+	inView("end")
+	if a.offset == 0 {
+		t.Fatal("list didn't scroll to the last command")
+	}
+	offset := a.offset
+	a.View()
+	if a.offset != offset {
+		t.Errorf("drawing moved the offset from %d to %d", offset, a.offset)
+	}
+
+	a.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+	inView("resize")
+
+	a.Update(key(tea.KeyHome))
+	inView("home")
+	if a.offset != 0 {
+		t.Errorf("offset = %d after home, want 0", a.offset)
+	}
+}
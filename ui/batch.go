@@ -0,0 +1,179 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"cmdbox/model"
+	"cmdbox/runner"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// batchRun is a marked command waiting its turn in a batch
+type batchRun struct {
+	cmd      model.Command
+	finalCmd string
+	histCmd  string // finalCmd with sensitive values masked
+	values   map[string]string
+}
+
+// toggleMark marks or unmarks the selected command for a batch run and
+// moves on to the next one
+func (a *App) toggleMark() {
+	id := a.filtered[a.cursor].ID
+	if a.marked[id] {
+		delete(a.marked, id)
+	} else {
+		if a.marked == nil {
+			a.marked = make(map[int64]bool)
+		}
+		a.marked[id] = true
+	}
+	if a.cursor < a.listLen()-1 {
+		a.cursor++
+	}
+}
+
+// startBatch runs the marked commands one after another, in list order,
+// with the params they were last run with. Nothing runs unless every one
+// of them can.
+func (a *App) startBatch() (tea.Model, tea.Cmd) {
+	if a.running {
+		a.err = "A command is already running"
+		return a, nil
+	}
+
+	var runs []batchRun
+	for _, c := range a.commands {
+		if !a.marked[c.ID] {
+			continue
+		}
+		if c.Interactive {
+			a.err = fmt.Sprintf("'%s' is interactive and can't run in a batch", c.Name)
+			return a, nil
+		}
+		run, err := a.prepareBatchRun(c)
+		if err != nil {
+			a.err = err.Error()
+			return a, nil
+		}
+		runs = append(runs, run)
+	}
+	if len(runs) == 0 {
+		a.info = "None of the marked commands are shown"
+		return a, nil
+	}
+
+	a.marked = nil
+	a.batch = runs
+	a.batchTotal = len(runs)
+	a.batchFailed = 0
+	a.resetOutput()
+	return a, a.nextBatchRun()
+}
+
+// prepareBatchRun fills c's params from their remembered values, the
+// environment or their defaults, failing if any is left without a value
+func (a *App) prepareBatchRun(c model.Command) (batchRun, error) {
+	params := runner.CommandParams(c)
+	saved := a.savedParamValues(c, params)
+	values := make(map[string]string, len(params))
+	for _, p := range params {
+		val, ok := saved[p.Name]
+		if env := p.FromEnv(); !ok && env != "" {
+			val, ok = env, true
+		}
+		if !ok && p.Default != "" {
+			val, ok = p.Default, true
+		}
+		if !ok {
+			return batchRun{}, fmt.Errorf("'%s' needs a value for %s; run it on its own first", c.Name, p.Name)
+		}
+		if err := runner.ValidateParam(p, val); err != nil {
+			return batchRun{}, fmt.Errorf("'%s': %v", c.Name, err)
+		}
+		values[p.Name] = val
+	}
+
+	finalCmd := runner.SubstituteParams(runner.StripComments(c.Cmd), values)
+	finalEnv := runner.SubstituteParamsRaw(c.Env, values)
+	if left := runner.FindUnsubstituted(finalCmd + "\n" + finalEnv); len(left) > 0 {
+		return batchRun{}, fmt.Errorf("'%s' has unfilled params: %s", c.Name, strings.Join(left, ", "))
+	}
+	return batchRun{
+		cmd:      c,
+		finalCmd: finalCmd,
+		histCmd:  runner.SubstituteParams(runner.StripComments(c.Cmd), runner.MaskSensitive(params, values)),
+		values:   values,
+	}, nil
+}
+
+// nextBatchRun starts the first command left in the batch
+func (a *App) nextBatchRun() tea.Cmd {
+	run := a.batch[0]
+	a.batch = a.batch[1:]
+
+	a.db.UpdateLastUsed(run.cmd.ID)
+	a.refreshCommands()
+	a.lastRun = &run.cmd
+	a.lastValues = run.values
+	return a.startRun(run.cmd, run.finalCmd, run.histCmd, run.values)
+}
+
+// continueBatch decides what follows a batch command that has finished:
+// the next command, a prompt after a failure, or the end of the batch
+func (a *App) continueBatch(msg outputMsg) tea.Cmd {
+	failed := msg.Interrupted || msg.ErrMsg != "" || msg.ExitCode != 0
+	if failed {
+		a.batchFailed++
+	}
+
+	switch {
+	case len(a.batch) == 0 || msg.Interrupted:
+		a.endBatch()
+	case !failed || a.batchOnFailure == "continue":
+		return a.nextBatchRun()
+	case a.batchOnFailure == "ask" && a.mode == modeNormal:
+		a.mode = modeConfirmBatch
+	default:
+		// Stopping is the safe answer when there's nobody to ask
+		a.endBatch()
+	}
+	return nil
+}
+
+// endBatch writes a summary of the batch under its output and drops any
+// commands that didn't get to run
+func (a *App) endBatch() {
+	summary := fmt.Sprintf("Batch: ran %d of %d", a.batchTotal-len(a.batch), a.batchTotal)
+	if a.batchFailed > 0 {
+		summary += fmt.Sprintf(", %d failed", a.batchFailed)
+	}
+	a.appendOutput("", mutedStyle.Render(summary))
+	a.batch = nil
+	a.batchTotal = 0
+	a.batchFailed = 0
+}
+
+func (a *App) updateConfirmBatch(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "y", "Y":
+		a.mode = modeNormal
+		return a, a.nextBatchRun()
+
+	case "n", "N", "esc":
+		a.mode = modeNormal
+		a.endBatch()
+		a.setOutput()
+		a.output.GotoBottom()
+	}
+	return a, nil
+}
+
+// batchHeader separates the output of the batch's current command from
+// the one before
+func (a *App) batchHeader(name string) string {
+	n := a.batchTotal - len(a.batch)
+	return labelStyle.Render(fmt.Sprintf("── [%d/%d] %s ──", n, a.batchTotal, name))
+}
@@ -0,0 +1,138 @@
+package ui
+
+import (
+	"slices"
+	"strings"
+
+	"cmdbox/model"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// sidebarWidth is the width of the category sidebar, borders included
+const sidebarWidth = 22
+
+// showSidebar reports whether the Bash tab has categories to list
+func (a *App) showSidebar() bool {
+	return a.tab == tabBash && len(a.categories) > 0
+}
+
+// refreshCategories reloads the sidebar, falling back to "All" if the
+// selected category no longer exists
+func (a *App) refreshCategories() {
+	categories, err := a.db.ListCategories(a.showArchived)
+	if err != nil {
+		a.err = err.Error()
+		return
+	}
+	a.categories = categoryTree(categories)
+	if !slices.Contains(a.categories, a.category) {
+		a.category = ""
+	}
+	if len(a.categories) == 0 {
+		a.sidebarFocus = false
+	}
+}
+
+// updateSidebar handles keys while the sidebar has focus. It reports false
+// for keys the sidebar doesn't use, so they fall through to the list.
+func (a *App) updateSidebar(msg tea.KeyMsg) (tea.Model, tea.Cmd, bool) {
+	switch msg.String() {
+	case "up", "k":
+		a.moveCategory(-1)
+	case "down", "j":
+		a.moveCategory(1)
+	case "L", "enter", "esc":
+		a.sidebarFocus = false
+	default:
+		return a, nil, false
+	}
+	return a, nil, true
+}
+
+// moveCategory selects the category delta rows away, where the row above
+// the first category is "All"
+func (a *App) moveCategory(delta int) {
+	// "All" is index -1
+	idx := slices.Index(a.categories, a.category)
+	idx = max(min(idx+delta, len(a.categories)-1), -1)
+	if idx < 0 {
+		a.category = ""
+	} else {
+		a.category = a.categories[idx]
+	}
+	a.cursor = 0
+	a.offset = 0
+	a.filterCommands()
+}
+
+// renderSidebar lists "All" and the category tree, indented by depth
+func (a *App) renderSidebar(height int) string {
+	rows := append([]string{""}, a.categories...)
+	selected := slices.Index(rows, a.category)
+
+	// List items take two lines each, so the sidebar gets the same space
+	visible := height * 2
+	start := max(min(selected-visible/2, len(rows)-visible), 0)
+	end := min(start+visible, len(rows))
+
+	var lines []string
+	for i := start; i < end; i++ {
+		indent, label := "", "All"
+		if rows[i] != "" {
+			indent = strings.Repeat("  ", strings.Count(rows[i], "/"))
+			label = rows[i][strings.LastIndex(rows[i], "/")+1:]
+		}
+		prefix := "  "
+		style := normalStyle
+		if i == selected {
+			prefix = "▸ "
+			style = selectedStyle
+		}
+		lines = append(lines, style.Render(truncate(indent+prefix+label, sidebarWidth-4)))
+	}
+
+	box := borderStyle.Width(sidebarWidth - 2)
+	if a.sidebarFocus {
+		box = box.BorderForeground(primary)
+	}
+	return box.Render(strings.Join(lines, "\n"))
+}
+
+// inCategory reports whether c is in category or one of its subcategories.
+// The empty category matches everything.
+func inCategory(c model.Command, category string) bool {
+	return category == "" || c.Category == category || strings.HasPrefix(c.Category, category+"/")
+}
+
+// categoryTree adds the parents of nested categories, so "infra/aws" also
+// lists "infra", and sorts parents right before their children
+func categoryTree(categories []string) []string {
+	seen := make(map[string]bool)
+	var tree []string
+	for _, c := range categories {
+		parts := strings.Split(c, "/")
+		for i := range parts {
+			path := strings.Join(parts[:i+1], "/")
+			if !seen[path] {
+				seen[path] = true
+				tree = append(tree, path)
+			}
+		}
+	}
+	slices.SortFunc(tree, func(x, y string) int {
+		return slices.Compare(strings.Split(x, "/"), strings.Split(y, "/"))
+	})
+	return tree
+}
+
+// normalizeCategory trims each level of a category path and drops empty ones
+func normalizeCategory(s string) string {
+	var parts []string
+	for _, p := range strings.Split(s, "/") {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, "/")
+}
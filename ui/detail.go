@@ -0,0 +1,94 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"cmdbox/model"
+	"cmdbox/runner"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+// minDetailWidth is the narrowest terminal that gets a detail pane
+const minDetailWidth = 100
+
+// detailWidth is the width of the command detail pane, or 0 when the
+// terminal is too narrow to show it
+func (a *App) detailWidth() int {
+	if a.tab != tabBash || a.width < minDetailWidth {
+		return 0
+	}
+	return a.width * 2 / 5
+}
+
+// renderDetail shows everything about the selected command, wrapped to
+// the pane width and cut off at height lines
+func (a *App) renderDetail(height int) string {
+	width := a.detailWidth()
+	inner := width - 4 // border and padding
+
+	var lines []string
+	if len(a.filtered) == 0 {
+		lines = append(lines, mutedStyle.Render("Nothing selected"))
+	} else {
+		cmd := a.filtered[a.cursor]
+		field := func(label, value string) {
+			if value == "" {
+				return
+			}
+			lines = append(lines, "", labelStyle.Render(label))
+			lines = append(lines, strings.Split(ansi.Wrap(value, inner, ""), "\n")...)
+		}
+
+		lines = append(lines, strings.Split(ansi.Wrap(renderLabel(cmd.Label)+titleStyle.UnsetPadding().Render(cmd.Name), inner, ""), "\n")...)
+		field("Command", cmdPreviewStyle.Render(cmd.Cmd))
+		field("Description", cmd.Description)
+		if tags := cmd.TagList(); len(tags) > 0 {
+			field("Tags", strings.TrimSpace(renderTags(tags)))
+		}
+		field("Category", cmd.Category)
+		if cmd.Interactive {
+			field("Runs", "interactively, in the terminal")
+		}
+		if cmd.Locked {
+			field("Locked", "press K to unlock before editing or deleting")
+		}
+		field("Params", describeParams(cmd))
+		field("Created", cmd.CreatedAt.Local().Format("2006-01-02 15:04"))
+		if cmd.LastUsedAt != nil {
+			runs := "runs"
+			if cmd.UseCount == 1 {
+				runs = "run"
+			}
+			field("Last used", fmt.Sprintf("%s (%d %s)", cmd.LastUsedAt.Local().Format("2006-01-02 15:04"), cmd.UseCount, runs))
+		}
+	}
+
+	if len(lines) > height {
+		lines = append(lines[:height-1], mutedStyle.Render("…"))
+	}
+	return borderStyle.Width(width-2).Padding(0, 1).Render(strings.Join(lines, "\n"))
+}
+
+// describeParams lists a command's params as they'd be written, with
+// their type and default
+func describeParams(cmd model.Command) string {
+	var parts []string
+	for _, p := range runner.CommandParams(cmd) {
+		s := p.Name
+		if p.Sensitive {
+			s = "!" + s
+		}
+		if p.Type == "enum" {
+			s += ":enum(" + strings.Join(p.Choices, ",") + ")"
+		} else if p.Type != "" {
+			s += ":" + p.Type
+		}
+		if p.Default != "" {
+			s += " = " + p.Default
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, "\n")
+}
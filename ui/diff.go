@@ -0,0 +1,122 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is how many unchanged lines are shown around each change
+const diffContext = 3
+
+// diffLine is one line of a line diff: ' ' kept, '-' removed or '+' added
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// lineDiff returns the edits turning old into new, from their longest
+// common subsequence of lines. Commands are short, so the quadratic table
+// is fine.
+func lineDiff(old, new []string) []diffLine {
+	// lcs[i][j] is the LCS length of old[i:] and new[j:]
+	lcs := make([][]int, len(old)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(new)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(new) - 1; j >= 0; j-- {
+			if old[i] == new[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var diff []diffLine
+	i, j := 0, 0
+	for i < len(old) && j < len(new) {
+		switch {
+		case old[i] == new[j]:
+			diff = append(diff, diffLine{' ', old[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, diffLine{'-', old[i]})
+			i++
+		default:
+			diff = append(diff, diffLine{'+', new[j]})
+			j++
+		}
+	}
+	for ; i < len(old); i++ {
+		diff = append(diff, diffLine{'-', old[i]})
+	}
+	for ; j < len(new); j++ {
+		diff = append(diff, diffLine{'+', new[j]})
+	}
+	return diff
+}
+
+// renderDiff draws the changes from old to new as a unified diff, with
+// hunk headers and diffContext lines of context around each change
+func renderDiff(old, new string) string {
+	diff := lineDiff(strings.Split(old, "\n"), strings.Split(new, "\n"))
+
+	// Mark the lines close enough to a change to be shown
+	show := make([]bool, len(diff))
+	for i, d := range diff {
+		if d.op == ' ' {
+			continue
+		}
+		for k := max(i-diffContext, 0); k <= min(i+diffContext, len(diff)-1); k++ {
+			show[k] = true
+		}
+	}
+
+	var b strings.Builder
+	oldLine, newLine := 1, 1
+	for i := 0; i < len(diff); {
+		if !show[i] {
+			if diff[i].op != '+' {
+				oldLine++
+			}
+			if diff[i].op != '-' {
+				newLine++
+			}
+			i++
+			continue
+		}
+
+		end := i
+		for end < len(diff) && show[end] {
+			end++
+		}
+		var oldCount, newCount int
+		for _, d := range diff[i:end] {
+			if d.op != '+' {
+				oldCount++
+			}
+			if d.op != '-' {
+				newCount++
+			}
+		}
+		b.WriteString(mutedStyle.Render(fmt.Sprintf("@@ -%d,%d +%d,%d @@", oldLine, oldCount, newLine, newCount)))
+		b.WriteString("\n")
+		for _, d := range diff[i:end] {
+			switch d.op {
+			case '-':
+				b.WriteString(errorStyle.Render("- " + d.text))
+			case '+':
+				b.WriteString(successStyle.Render("+ " + d.text))
+			default:
+				b.WriteString(cmdPreviewStyle.Render("  " + d.text))
+			}
+			b.WriteString("\n")
+		}
+		oldLine += oldCount
+		newLine += newCount
+		i = end
+	}
+	return b.String()
+}
@@ -0,0 +1,195 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"cmdbox/model"
+	"cmdbox/runner"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// pagerDoneMsg reports that the pager started by openPager has exited
+type pagerDoneMsg struct {
+	err error
+}
+
+// openPager shows the output, with styling stripped, in the user's pager.
+// The TUI is suspended until the pager exits.
+func (a *App) openPager() tea.Cmd {
+	pager, err := findPager()
+	if err != nil {
+		a.err = err.Error()
+		return nil
+	}
+
+	f, err := os.CreateTemp("", "cmdbox-output-*.log")
+	if err != nil {
+		a.err = "Failed to open pager: " + err.Error()
+		return nil
+	}
+	_, err = f.WriteString(a.plainOutput() + "\n")
+	f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		a.err = "Failed to open pager: " + err.Error()
+		return nil
+	}
+
+	c := exec.Command(pager[0], append(pager[1:], f.Name())...)
+	return tea.ExecProcess(c, func(err error) tea.Msg {
+		os.Remove(f.Name())
+		return pagerDoneMsg{err: err}
+	})
+}
+
+// findPager returns the pager command line: $PAGER if set, otherwise less
+// or more, whichever is installed first
+func findPager() ([]string, error) {
+	if pager := strings.Fields(os.Getenv("PAGER")); len(pager) > 0 {
+		return pager, nil
+	}
+	for _, name := range []string{"less", "more"} {
+		if _, err := exec.LookPath(name); err == nil {
+			return []string{name}, nil
+		}
+	}
+	return nil, errors.New("no pager found, set $PAGER")
+}
+
+// editorDoneMsg reports that the editor started by openEditor has exited,
+// leaving the edited text in path
+type editorDoneMsg struct {
+	path string
+	err  error
+}
+
+// openEditor opens the form's command (or SQL) in the user's editor. The
+// TUI is suspended until the editor exits.
+func (a *App) openEditor() tea.Cmd {
+	text, ext := a.cmdTextarea.Value(), ".sh"
+	if a.tab == tabSQL {
+		text, ext = a.sqlTextarea.Value(), ".sql"
+	}
+
+	f, err := os.CreateTemp("", "cmdbox-*"+ext)
+	if err != nil {
+		a.err = "Failed to open editor: " + err.Error()
+		return nil
+	}
+	_, err = f.WriteString(text + "\n")
+	f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		a.err = "Failed to open editor: " + err.Error()
+		return nil
+	}
+
+	editor := findEditor()
+	c := exec.Command(editor[0], append(editor[1:], f.Name())...)
+	return tea.ExecProcess(c, func(err error) tea.Msg {
+		return editorDoneMsg{path: f.Name(), err: err}
+	})
+}
+
+// finishEditing puts the text saved in the editor back into the form.
+// An empty file leaves the form as it was.
+func (a *App) finishEditing(msg editorDoneMsg) tea.Cmd {
+	data, err := os.ReadFile(msg.path)
+	os.Remove(msg.path)
+	if msg.err != nil {
+		a.err = "Editor failed: " + msg.err.Error()
+		return nil
+	}
+	if err != nil {
+		a.err = "Failed to read edited text: " + err.Error()
+		return nil
+	}
+
+	text := strings.TrimRight(string(data), "\n")
+	if strings.TrimSpace(text) == "" {
+		a.info = "Editor left nothing, kept the original"
+		return nil
+	}
+	if a.tab == tabSQL {
+		a.sqlTextarea.SetValue(text)
+	} else {
+		a.cmdTextarea.SetValue(text)
+	}
+	a.formFocus = 1
+	return a.focusFormInput()
+}
+
+// findEditor returns the editor command line: $VISUAL or $EDITOR if set,
+// otherwise vi
+func findEditor() []string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if editor := strings.Fields(os.Getenv(env)); len(editor) > 0 {
+			return editor
+		}
+	}
+	return []string{"vi"}
+}
+
+// interactiveDoneMsg reports that an interactive command run in the
+// terminal by runInteractive has exited
+type interactiveDoneMsg struct {
+	cmdID    int64
+	histCmd  string
+	redacted bool
+	err      error
+}
+
+// runInteractive runs a command that needs the terminal. Inside tmux it
+// opens in a new window and cmdbox carries on; otherwise the TUI is
+// suspended until the command exits.
+func (a *App) runInteractive(cmd model.Command, finalCmd, histCmd string, values map[string]string) tea.Cmd {
+	opts := runner.CommandOptions(cmd, values, a.runConfig)
+	opts.Lookup = a.db.GetByName
+
+	if _, err := exec.LookPath("tmux"); err == nil && os.Getenv("TMUX") != "" {
+		c, err := runner.TmuxWindow(cmd.Name, finalCmd, opts)
+		if err != nil {
+			a.err = err.Error()
+			return nil
+		}
+		if out, err := c.CombinedOutput(); err != nil {
+			a.err = "Failed to open tmux window: " + strings.TrimSpace(string(out))
+			return nil
+		}
+		a.status = fmt.Sprintf("Opened '%s' in a new tmux window", cmd.Name)
+		return nil
+	}
+
+	c, err := runner.Interactive(finalCmd, opts)
+	if err != nil {
+		a.err = err.Error()
+		return nil
+	}
+	return tea.ExecProcess(c, func(err error) tea.Msg {
+		return interactiveDoneMsg{cmdID: cmd.ID, histCmd: histCmd, redacted: histCmd != finalCmd, err: err}
+	})
+}
+
+// finishInteractive records an interactive run in history once the TUI
+// is back
+func (a *App) finishInteractive(msg interactiveDoneMsg) {
+	code := 0
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(msg.err, &exitErr):
+		code = exitErr.ExitCode()
+		a.err = fmt.Sprintf("Exited with code %d", code)
+	case msg.err != nil:
+		code = -1
+		a.err = "Failed to run: " + msg.err.Error()
+	}
+	if err := a.db.AddHistory(msg.cmdID, msg.histCmd, msg.redacted, code); err != nil {
+		a.err = "Failed to record history: " + err.Error()
+	}
+	a.refreshHistory()
+}
@@ -0,0 +1,131 @@
+package ui
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Version is shown at the foot of the help modal
+var Version = "dev"
+
+// helpSection is one group of bindings in the help modal
+type helpSection struct {
+	title    string
+	bindings [][2]string // key, description
+}
+
+func (a *App) updateHelp(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return a, a.quit()
+
+	case "?", "esc":
+		a.mode = modeNormal
+	}
+	return a, nil
+}
+
+// helpSections lists every keybinding, grouped by where it applies
+func (a *App) helpSections() []helpSection {
+	k := a.keys
+	return []helpSection{
+		{"Navigation", [][2]string{
+			{"up/k, down/j", "move selection"},
+			{"pgup/ctrl+b, pgdown/ctrl+f", "move a page"},
+			{"home, end/G", "jump to the first / last item"},
+			{"tab", "switch between Bash, SQL and History"},
+			{"H, L", "focus category sidebar / back to list"},
+			{"type", "search (name:, cmd:, desc:, tag: or #tag narrow it)"},
+			{"right", "accept the suggested name"},
+			{"esc", "clear search, then marks"},
+		}},
+		{"List actions", [][2]string{
+			{k.Run, "run selected (rerun on History)"},
+			{"alt+enter", "preview run: leaves last used time and params alone"},
+			{"F", "run the query in full, past the preview row limit"},
+			{"M", "mark command; " + k.Run + " then runs the marked ones in turn"},
+			{"ctrl+r", "run the last command again with the same params"},
+			{k.Add, "add"},
+			{"ctrl+v", "add from the clipboard"},
+			{k.Edit, "edit"},
+			{k.Delete, "delete"},
+			{k.Yank, "copy command to clipboard"},
+			{"ctrl+y", "copy command with its params filled in"},
+			{"V", "view the full command, query or run"},
+			{"ctrl+s", "sort by recent / most used / name / created / manual"},
+			{"ctrl+up, ctrl+down", "move command up / down, in manual sort"},
+			{"ctrl+p", "show commands with / without params / all"},
+			{"K", "lock / unlock command against edits and deletes"},
+			{"Z", "archive / restore command"},
+			{"ctrl+z", "show archived commands / the rest"},
+			{"B", "save command as a shell script"},
+			{"X", "export library to JSON"},
+			{"?", "toggle this help"},
+			{k.Quit + ", ctrl+c", "quit"},
+		}},
+		{"Output", [][2]string{
+			{"ctrl+x", "stop the running command or query"},
+			{"ctrl+o", "focus the output to scroll it / back to the list"},
+			{"C", "clear output"},
+			{"ctrl+n", "toggle adding each run to the output instead of replacing it"},
+			{"ctrl+l", "toggle wrapping long lines"},
+			{"O", "copy output to clipboard"},
+			{"P", "open output in $PAGER"},
+			{"W", "write output to a log file"},
+			{"R", "save query results as CSV"},
+		}},
+		{"Forms", [][2]string{
+			{"down/tab, up/shift+tab", "next / previous field"},
+			{"enter, S", "save (enter adds a newline in text areas)"},
+			{"ctrl+o", "edit the command or SQL in $EDITOR"},
+			{"left, right", "pick a label color, in the Label field"},
+			{"ctrl+t", "toggle running the command interactively"},
+			{"esc", "cancel"},
+		}},
+		{"Params", [][2]string{
+			{"enter", "run with the entered values"},
+			{"ctrl+d", "preview the command without running"},
+			{"ctrl+t", "switch between inline and one param per line"},
+			{"tab", "next param, when one per line"},
+			{"up, down", "older / newer value of the param at the cursor"},
+			{"esc", "cancel"},
+		}},
+		{"Editing search and params", [][2]string{
+			{"ctrl+a, ctrl+e", "jump to the start / end of the line"},
+			{"ctrl+w", "delete the word before the cursor"},
+			{"ctrl+u, ctrl+k", "delete to the start / end of the line"},
+			{"alt+b, alt+f", "move back / forward a word"},
+		}},
+	}
+}
+
+// renderHelpModal draws the full keybinding reference in a bordered box
+func (a *App) renderHelpModal() string {
+	sections := a.helpSections()
+
+	keyWidth := 0
+	for _, s := range sections {
+		for _, b := range s.bindings {
+			keyWidth = max(keyWidth, lipgloss.Width(b[0]))
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(titleStyle.Render("Keybindings"))
+	b.WriteString("\n")
+	for _, s := range sections {
+		b.WriteString("\n")
+		b.WriteString(labelStyle.Render(s.title))
+		b.WriteString("\n")
+		for _, bind := range s.bindings {
+			key := helpKeyStyle.Width(keyWidth).Render(bind[0])
+			b.WriteString("  " + key + "  " + helpStyle.Render(bind[1]) + "\n")
+		}
+	}
+	b.WriteString("\n")
+	b.WriteString(mutedStyle.Render("? or esc to close · cmdbox " + Version))
+
+	return borderStyle.Padding(0, 1).Render(b.String())
+}
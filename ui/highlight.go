@@ -0,0 +1,146 @@
+package ui
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+var sqlKeywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "JOIN": true, "LEFT": true,
+	"RIGHT": true, "INNER": true, "OUTER": true, "FULL": true, "CROSS": true,
+	"ON": true, "USING": true, "AND": true, "OR": true, "NOT": true, "IN": true,
+	"IS": true, "NULL": true, "AS": true, "ORDER": true, "BY": true, "GROUP": true,
+	"HAVING": true, "LIMIT": true, "OFFSET": true, "INSERT": true, "INTO": true,
+	"VALUES": true, "UPDATE": true, "SET": true, "DELETE": true, "CREATE": true,
+	"TABLE": true, "DROP": true, "ALTER": true, "INDEX": true, "VIEW": true,
+	"DISTINCT": true, "UNION": true, "ALL": true, "CASE": true, "WHEN": true,
+	"THEN": true, "ELSE": true, "END": true, "LIKE": true, "ILIKE": true,
+	"BETWEEN": true, "EXISTS": true, "ASC": true, "DESC": true, "WITH": true,
+	"RETURNING": true, "TRUE": true, "FALSE": true, "PRIMARY": true, "KEY": true,
+	"DEFAULT": true, "EXPLAIN": true,
+}
+
+// highlightSQL colors keywords, numbers, string literals and comments. It
+// is a plain lexer, not a parser, so malformed SQL still renders: an
+// unterminated string or comment just runs to the end.
+func highlightSQL(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+	plainStart := 0
+
+	flush := func(end int) {
+		if end > plainStart {
+			b.WriteString(paint(mutedStyle, string(runes[plainStart:end])))
+		}
+	}
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+
+		switch {
+		case r == '\'' || r == '"':
+			// String literal or quoted identifier; doubled quotes escape
+			i++
+			for i < len(runes) {
+				if runes[i] == r {
+					if i+1 < len(runes) && runes[i+1] == r {
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				i++
+			}
+			flush(start)
+			b.WriteString(paint(sqlStringStyle, string(runes[start:i])))
+			plainStart = i
+
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			flush(start)
+			b.WriteString(paint(sqlCommentStyle, string(runes[start:i])))
+			plainStart = i
+
+		case unicode.IsDigit(r):
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			flush(start)
+			b.WriteString(sqlNumberStyle.Render(string(runes[start:i])))
+			plainStart = i
+
+		case unicode.IsLetter(r) || r == '_':
+			for i < len(runes) && isIdentRune(runes[i]) {
+				i++
+			}
+			word := string(runes[start:i])
+			if sqlKeywords[strings.ToUpper(word)] {
+				flush(start)
+				b.WriteString(sqlKeywordStyle.Render(word))
+				plainStart = i
+			}
+
+		default:
+			i++
+		}
+	}
+	flush(len(runes))
+
+	return b.String()
+}
+
+// paint styles each line of s on its own, so multi-line tokens aren't
+// padded to a common width the way a single Render would
+func paint(style lipgloss.Style, s string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		if l != "" {
+			lines[i] = style.Render(l)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isIdentRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// highlightMatches renders s in style with its fuzzy-matched characters
+// picked out. matched holds byte offsets into the whole search target, in
+// which s starts at offset.
+func highlightMatches(s string, matched []int, offset int, style lipgloss.Style) string {
+	hits := make(map[int]bool)
+	for _, i := range matched {
+		if i >= offset && i < offset+len(s) {
+			hits[i-offset] = true
+		}
+	}
+	if len(hits) == 0 {
+		return style.Render(s)
+	}
+
+	hitStyle := matchStyle.Inherit(style)
+	render := func(part string, hit bool) string {
+		if hit {
+			return hitStyle.Render(part)
+		}
+		return style.Render(part)
+	}
+
+	var b strings.Builder
+	runStart, inHit := 0, hits[0]
+	for i := range s {
+		if hits[i] != inHit {
+			b.WriteString(render(s[runStart:i], inHit))
+			runStart, inHit = i, hits[i]
+		}
+	}
+	b.WriteString(render(s[runStart:], inHit))
+	return b.String()
+}
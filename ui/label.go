@@ -0,0 +1,58 @@
+package ui
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// labelInputIndex is the form input holding a command's label
+const labelInputIndex = 7
+
+// labelColors are the palette a label can be picked from. They're ANSI
+// colors so they follow the terminal's own scheme.
+var labelColors = map[string]lipgloss.Color{
+	"red":     "1",
+	"green":   "2",
+	"yellow":  "3",
+	"blue":    "4",
+	"magenta": "5",
+	"cyan":    "6",
+	"gray":    "8",
+}
+
+// labelPalette is the order left/right cycle through, starting from no label
+var labelPalette = []string{"", "red", "yellow", "green", "cyan", "blue", "magenta", "gray"}
+
+// cycleLabel returns the palette entry delta steps from label. Text that
+// isn't a palette color, like an emoji, starts the cycle over.
+func cycleLabel(label string, delta int) string {
+	i := slices.Index(labelPalette, strings.ToLower(strings.TrimSpace(label)))
+	if i < 0 {
+		i = 0
+	}
+	n := len(labelPalette)
+	return labelPalette[((i+delta)%n+n)%n]
+}
+
+// normalizeLabel lowercases palette color names and trims anything else
+func normalizeLabel(s string) string {
+	s = strings.TrimSpace(s)
+	if _, ok := labelColors[strings.ToLower(s)]; ok {
+		return strings.ToLower(s)
+	}
+	return s
+}
+
+// renderLabel draws a label as a colored dot, or as written for anything
+// that isn't a palette color, followed by a space. No label renders as "".
+func renderLabel(label string) string {
+	if label == "" {
+		return ""
+	}
+	if color, ok := labelColors[label]; ok {
+		return lipgloss.NewStyle().Foreground(color).Render("●") + " "
+	}
+	return label + " "
+}
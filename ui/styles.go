@@ -1,84 +1,164 @@
 package ui
 
-import "github.com/charmbracelet/lipgloss"
+import (
+	"cmdbox/config"
+
+	"github.com/charmbracelet/lipgloss"
+)
 
 var (
 	// Colors
-	primary   = lipgloss.Color("99")  // purple
-	secondary = lipgloss.Color("240") // gray
-	accent    = lipgloss.Color("86")  // green
-	danger    = lipgloss.Color("196") // red
+	primary   lipgloss.Color
+	secondary lipgloss.Color
+	accent    lipgloss.Color
+	danger    lipgloss.Color
+
+	appStyle          lipgloss.Style
+	mutedStyle        lipgloss.Style
+	borderStyle       lipgloss.Style
+	titleStyle        lipgloss.Style
+	selectedStyle     lipgloss.Style
+	normalStyle       lipgloss.Style
+	cmdPreviewStyle   lipgloss.Style
+	tagStyle          lipgloss.Style
+	outputTitleStyle  lipgloss.Style
+	outputStyle       lipgloss.Style
+	errorStyle        lipgloss.Style
+	tableHeaderStyle  lipgloss.Style
+	tableCellStyle    lipgloss.Style
+	helpStyle         lipgloss.Style
+	helpKeyStyle      lipgloss.Style
+	labelStyle        lipgloss.Style
+	inputStyle        lipgloss.Style
+	focusedInputStyle lipgloss.Style
+	successStyle      lipgloss.Style
+	warningStyle      lipgloss.Style
+	sqlKeywordStyle   lipgloss.Style
+	sqlNumberStyle    lipgloss.Style
+	sqlStringStyle    lipgloss.Style
+	sqlCommentStyle   lipgloss.Style
+	matchStyle        lipgloss.Style
+
+	tagColors = []lipgloss.Color{"62", "30", "130", "125", "24", "90"}
+)
+
+func init() {
+	setupStyles(config.Themes["default"])
+}
+
+// setupStyles builds every style from the theme's colors
+func setupStyles(t config.Theme) {
+	primary = lipgloss.Color(t.Primary)
+	secondary = lipgloss.Color(t.Secondary)
+	accent = lipgloss.Color(t.Accent)
+	danger = lipgloss.Color(t.Danger)
 
 	// App container
 	appStyle = lipgloss.NewStyle().
-			Padding(1, 2)
+		Padding(1, 2)
 
 	mutedStyle = lipgloss.NewStyle().
 		Foreground(lipgloss.Color("245"))
 
 	// Borders
 	borderStyle = lipgloss.NewStyle().
-			Border(lipgloss.RoundedBorder()).
-			BorderForeground(secondary)
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(secondary)
 
 	// Title
 	titleStyle = lipgloss.NewStyle().
-			Bold(true).
-			Foreground(primary).
-			Padding(0, 1)
+		Bold(true).
+		Foreground(primary).
+		Padding(0, 1)
 
 	// List items
 	selectedStyle = lipgloss.NewStyle().
-			Bold(true).
-			Foreground(accent)
+		Bold(true).
+		Foreground(accent)
 
 	normalStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("252"))
+		Foreground(lipgloss.Color("252"))
 
 	cmdPreviewStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("245")).
-			Italic(true)
+		Foreground(lipgloss.Color("245")).
+		Italic(true)
+
+	// Search matches within list items
+	matchStyle = lipgloss.NewStyle().
+		Foreground(primary).
+		Bold(true).
+		Underline(true)
+
+	// Tag chips
+	tagStyle = lipgloss.NewStyle().
+		Foreground(lipgloss.Color("231")).
+		Padding(0, 1)
 
 	// Output pane
 	outputTitleStyle = lipgloss.NewStyle().
-				Bold(true).
-				Foreground(secondary)
+		Bold(true).
+		Foreground(secondary)
 
 	outputStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("252"))
+		Foreground(lipgloss.Color("252"))
 
 	errorStyle = lipgloss.NewStyle().
-			Foreground(danger)
+		Foreground(danger)
+
+	// Query results
+	tableHeaderStyle = lipgloss.NewStyle().
+		Bold(true).
+		Foreground(primary).
+		Padding(0, 1)
+
+	tableCellStyle = lipgloss.NewStyle().
+		Foreground(lipgloss.Color("252")).
+		Padding(0, 1)
 
 	// Help bar
 	helpStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("245"))
+		Foreground(lipgloss.Color("245"))
 
 	helpKeyStyle = lipgloss.NewStyle().
-			Foreground(primary).
-			Bold(true)
+		Foreground(primary).
+		Bold(true)
 
 	// Form
 	labelStyle = lipgloss.NewStyle().
-			Foreground(primary).
-			Bold(true)
+		Foreground(primary).
+		Bold(true)
 
 	inputStyle = lipgloss.NewStyle().
-			Border(lipgloss.NormalBorder()).
-			BorderForeground(secondary).
-			Padding(0, 1)
+		Border(lipgloss.NormalBorder()).
+		BorderForeground(secondary).
+		Padding(0, 1)
 
 	focusedInputStyle = lipgloss.NewStyle().
-				Border(lipgloss.NormalBorder()).
-				BorderForeground(primary).
-				Padding(0, 1)
+		Border(lipgloss.NormalBorder()).
+		BorderForeground(primary).
+		Padding(0, 1)
 
 	// Status messages
 	successStyle = lipgloss.NewStyle().
-			Foreground(accent).
-			Bold(true)
+		Foreground(accent).
+		Bold(true)
 
 	warningStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("214")).
-			Bold(true)
-)
+		Foreground(lipgloss.Color("214")).
+		Bold(true)
+
+	// SQL highlighting
+	sqlKeywordStyle = lipgloss.NewStyle().
+		Foreground(primary).
+		Bold(true)
+
+	sqlNumberStyle = lipgloss.NewStyle().
+		Foreground(lipgloss.Color("214"))
+
+	sqlStringStyle = lipgloss.NewStyle().
+		Foreground(accent)
+
+	sqlCommentStyle = lipgloss.NewStyle().
+		Foreground(secondary).
+		Italic(true)
+}
@@ -0,0 +1,126 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"cmdbox/runner"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// maxColumnWidth caps how wide a result column grows; longer values are
+// cut with "…". Copying or saving the results keeps them whole.
+const maxColumnWidth = 40
+
+// renderResult formats query rows as a table for the output pane, fitted
+// to width
+func renderResult(rows []runner.Row, width int) string {
+	if len(rows) == 0 {
+		return mutedStyle.Render("(no rows)")
+	}
+
+	null := mutedStyle.Render("NULL")
+	cells := make([][]string, len(rows))
+	for i, r := range rows {
+		cells[i] = make([]string, len(r.Values))
+		for j, v := range r.Values {
+			if v == nil {
+				cells[i][j] = null
+				continue
+			}
+			// Line breaks would split the row across table lines
+			cells[i][j] = strings.ReplaceAll(runner.FormatValue(v), "\n", "↵")
+		}
+	}
+	return renderTable(rows[0].Columns, cells, width)
+}
+
+// renderTable lays out rows under column headers in a bordered box with a
+// row count below. Each column is as wide as its widest value, up to
+// maxColumnWidth, and columns of numbers are right-aligned. Columns that
+// don't fit in width are left out and named in the footer.
+func renderTable(columns []string, rows [][]string, width int) string {
+	widths := make([]int, len(columns))
+	numbers := make([]int, len(columns)) // numeric cells in each column
+	text := make([]bool, len(columns))   // whether a column has any other value
+	for i, c := range columns {
+		widths[i] = lipgloss.Width(c)
+	}
+	null := mutedStyle.Render("NULL")
+	for _, r := range rows {
+		for i, cell := range r {
+			if i >= len(columns) {
+				break
+			}
+			widths[i] = max(widths[i], lipgloss.Width(cell))
+			if cell == null {
+				continue
+			}
+			if _, err := strconv.ParseFloat(cell, 64); err == nil {
+				numbers[i]++
+			} else {
+				text[i] = true
+			}
+		}
+	}
+
+	// Every column takes its padding and a border on top of its width, and
+	// the table a border on the left. The first column is always shown.
+	shown := 0
+	used := 1
+	for i := range widths {
+		widths[i] = min(widths[i], maxColumnWidth)
+		if shown > 0 && used+widths[i]+3 > width {
+			break
+		}
+		used += widths[i] + 3
+		shown++
+	}
+
+	fit := func(cells []string) []string {
+		out := make([]string, shown)
+		for i := range out {
+			if i < len(cells) {
+				out[i] = ansi.Truncate(cells[i], widths[i], "…")
+			}
+		}
+		return out
+	}
+	fitted := make([][]string, len(rows))
+	for i, r := range rows {
+		fitted[i] = fit(r)
+	}
+
+	t := table.New().
+		Border(lipgloss.RoundedBorder()).
+		BorderStyle(lipgloss.NewStyle().Foreground(secondary)).
+		Headers(fit(columns)...).
+		Rows(fitted...).
+		StyleFunc(func(row, col int) lipgloss.Style {
+			style := tableCellStyle
+			if row == table.HeaderRow {
+				style = tableHeaderStyle
+			}
+			if numbers[col] > 0 && !text[col] {
+				style = style.Align(lipgloss.Right)
+			}
+			return style
+		})
+
+	footer := fmt.Sprintf("%d rows", len(rows))
+	if len(rows) == 1 {
+		footer = "1 row"
+	}
+	if hidden := columns[shown:]; len(hidden) > 0 {
+		noun := "columns"
+		if len(hidden) == 1 {
+			noun = "column"
+		}
+		footer += fmt.Sprintf(", %d %s not shown: %s", len(hidden), noun, strings.Join(hidden, ", "))
+	}
+	return t.Render() + "\n" + mutedStyle.Render(footer)
+}
@@ -0,0 +1,89 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// openViewer shows the full text of the selected command, query or
+// history entry in a scrollable modal, without running it
+func (a *App) openViewer() {
+	if a.listLen() == 0 {
+		return
+	}
+
+	switch a.tab {
+	case tabBash:
+		c := a.filtered[a.cursor]
+		a.viewerTitle = c.Name
+		a.viewerText = c.Cmd
+		if c.Env != "" {
+			a.viewerText += "\n\n" + labelStyle.Render("Environment:") + "\n" + c.Env
+		}
+	case tabSQL:
+		q := a.filteredQueries[a.cursor]
+		a.viewerTitle = q.Name
+		a.viewerText = highlightSQL(q.SQL)
+	default:
+		h := a.filteredHistory[a.cursor]
+		a.viewerTitle = h.CommandName
+		a.viewerText = h.FinalCmd
+	}
+
+	a.mode = modeView
+	a.layoutViewer()
+	a.viewer.GotoTop()
+}
+
+// layoutViewer fits the viewer to the window, rewrapping its text
+func (a *App) layoutViewer() {
+	a.viewer.Width = max(a.width-4, 1) // border and padding
+	text := ansi.Wrap(a.viewerText, a.viewer.Width, "")
+	// Short text gets a small box; long text fills the window, less the
+	// border, title and footer
+	a.viewer.Height = max(min(strings.Count(text, "\n")+1, a.height-6), 1)
+	a.viewer.SetContent(text)
+}
+
+func (a *App) updateViewer(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return a, a.quit()
+
+	case "V", "esc", "q":
+		a.mode = modeNormal
+		return a, nil
+
+	case "home", "g":
+		a.viewer.GotoTop()
+		return a, nil
+
+	case "end", "G":
+		a.viewer.GotoBottom()
+		return a, nil
+	}
+
+	var cmd tea.Cmd
+	a.viewer, cmd = a.viewer.Update(msg)
+	return a, cmd
+}
+
+// renderViewer draws the viewer modal in a bordered box
+func (a *App) renderViewer() string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(a.viewerTitle))
+	b.WriteString("\n\n")
+	b.WriteString(a.viewer.View())
+	b.WriteString("\n\n")
+
+	footer := "esc to close"
+	if !a.viewer.AtTop() || !a.viewer.AtBottom() {
+		footer = fmt.Sprintf("↑/↓ to scroll (%d%%), esc to close", int(a.viewer.ScrollPercent()*100))
+	}
+	b.WriteString(mutedStyle.Render(footer))
+
+	return borderStyle.Padding(0, 1).Render(b.String())
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"runtime/debug"
+	"strings"
+)
+
+// Build info, set with -ldflags, e.g.
+//
+//	go build -ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.date=$(date -u +%F)"
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
+)
+
+// versionString describes the build, like "v1.2.0 (abc1234, 2024-05-01)".
+// Whatever -ldflags left unset is taken from the module version and VCS
+// details Go records in the binary, as go install does.
+func versionString() string {
+	v, c, d := version, commit, date
+	if info, ok := debug.ReadBuildInfo(); ok {
+		// Local builds get a v0.0.0 pseudo-version that says less than
+		// the commit does
+		if mv := info.Main.Version; v == "dev" && mv != "" && mv != "(devel)" && !strings.HasPrefix(mv, "v0.0.0-") {
+			v = mv
+		}
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && c == "":
+				c = s.Value[:min(len(s.Value), 7)]
+			case s.Key == "vcs.time" && d == "":
+				d = s.Value[:min(len(s.Value), 10)]
+			}
+		}
+	}
+
+	if c == "" && d == "" {
+		return v
+	}
+	details := c
+	if d != "" && c != "" {
+		details += ", " + d
+	} else if d != "" {
+		details = d
+	}
+	return v + " (" + details + ")"
+}